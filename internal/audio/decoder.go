@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	oggopus "github.com/kvizyx/voicelog/pkg/ogg-opus"
+	"gopkg.in/hraban/opus.v2"
+)
+
+// Decode decodes the first logical stream of Ogg Opus input into interleaved stereo 48kHz pcm,
+// passing it to the handler piece by piece. Pre-skip of the stream is dropped and output gain
+// of the stream is applied.
+func Decode(in io.Reader, handle func(pcm []int16) error) error {
+	decoder, err := opus.NewDecoder(SampleRate, Channels)
+	if err != nil {
+		return fmt.Errorf("failed to create opus decoder: %w", err)
+	}
+
+	var (
+		reader  = oggopus.NewReader(in)
+		pcm     = make([]int16, SampleRate/1000*120*Channels)
+		serial  uint32
+		started bool
+		preSkip int
+		gain    float64
+	)
+
+	for {
+		packet, err := reader.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read opus packet: %w", err)
+		}
+
+		if !started {
+			serial, started = packet.Serial, true
+
+			head, _ := reader.Head(serial)
+			preSkip = int(head.PreSkip)
+			gain = math.Pow(10, float64(head.OutputGain)/256/20)
+		}
+
+		if packet.Serial != serial {
+			continue
+		}
+
+		n, err := decoder.Decode(packet.Data, pcm)
+		if err != nil {
+			return fmt.Errorf("failed to decode opus packet: %w", err)
+		}
+
+		skip := min(n, preSkip)
+		preSkip -= skip
+
+		if skip == n {
+			continue
+		}
+
+		if gain != 1 {
+			for i := range pcm[:n*Channels] {
+				pcm[i] = int16(max(math.MinInt16, min(math.MaxInt16, float64(pcm[i])*gain)))
+			}
+		}
+
+		if err = handle(pcm[skip*Channels : n*Channels]); err != nil {
+			return err
+		}
+	}
+}
+
+// wavHeaderSize is a size of the canonical WAVE header, without any chunks but "fmt " and "data".
+const wavHeaderSize = 44
+
+// DecodeFormat decodes input in given format into interleaved stereo 48kHz pcm. Ogg Opus and
+// 16-bit stereo 48kHz WAVE, which the encoders of this package produce, are supported.
+func DecodeFormat(format Format, in io.Reader, handle func(pcm []int16) error) error {
+	switch format {
+	case FormatOpus:
+		return Decode(in, handle)
+	case FormatWAV:
+		return decodeWAV(in, handle)
+	default:
+		return fmt.Errorf("decoding of %s is not supported", format)
+	}
+}
+
+// decodeWAV decodes WAVE file with the canonical header, as it is written by wav.Writer.
+// Sizes in the header are ignored, as they are not known when the output is not seekable.
+func decodeWAV(in io.Reader, handle func(pcm []int16) error) error {
+	header := make([]byte, wavHeaderSize)
+
+	if _, err := io.ReadFull(in, header); err != nil {
+		return fmt.Errorf("failed to read wave header: %w", err)
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" || string(header[36:40]) != "data" {
+		return errors.New("unsupported wave header")
+	}
+
+	if channels := binary.LittleEndian.Uint16(header[22:]); channels != Channels {
+		return fmt.Errorf("unsupported number of wave channels: %d", channels)
+	}
+
+	var (
+		data = make([]byte, SampleRate/1000*20*Channels*2) // 20 ms
+		pcm  = make([]int16, len(data)/2)
+	)
+
+	for {
+		n, err := io.ReadFull(in, data)
+		n -= n % (Channels * 2) // incomplete sample frame at the end
+
+		for i := range pcm[:n/2] {
+			pcm[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+		}
+
+		if n != 0 {
+			if handleErr := handle(pcm[:n/2]); handleErr != nil {
+				return handleErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read wave data: %w", err)
+		}
+	}
+}
+
+// Transcode decodes Ogg Opus input and encodes it into the output in given format.
+func Transcode(out io.Writer, in io.Reader, format Format) error {
+	encoder, err := NewEncoder(format, out)
+	if err != nil {
+		return err
+	}
+
+	if err = Decode(in, encoder.Write); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
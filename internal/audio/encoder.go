@@ -0,0 +1,125 @@
+// Package audio provides encoding and decoding of the recorded audio in supported formats.
+package audio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/kvizyx/voicelog/pkg/flac"
+	oggopus "github.com/kvizyx/voicelog/pkg/ogg-opus"
+	"github.com/kvizyx/voicelog/pkg/wav"
+	"gopkg.in/hraban/opus.v2"
+)
+
+const (
+	SampleRate   = 48000
+	Channels     = 2
+	FrameSamples = SampleRate / 50 // 20ms of audio per channel
+
+	// EncoderLookahead is a delay of libopus encoder at 48kHz, which is
+	// used as pre-skip of the streams it encodes.
+	EncoderLookahead = 312
+)
+
+// Encoder encodes interleaved stereo 48kHz pcm.
+type Encoder interface {
+	Write(pcm []int16) error
+	// Close finishes encoding, but does not close the output.
+	Close() error
+}
+
+// NewEncoder creates encoder writing into the output in given format. Comments in the
+// "KEY=value" form are written into the stream if the format is Opus.
+func NewEncoder(format Format, out io.Writer, comments ...string) (Encoder, error) {
+	switch format {
+	case FormatOpus:
+		return newOpusEncoder(out, comments)
+	case FormatWAV:
+		return wav.NewWriter(out, SampleRate, Channels), nil
+	case FormatFLAC:
+		return flac.NewEncoder(out, SampleRate, Channels)
+	default:
+		return nil, fmt.Errorf("unknown audio format: %q", format)
+	}
+}
+
+// opusEncoder encodes pcm into Ogg Opus stream frame by frame.
+type opusEncoder struct {
+	encoder *opus.Encoder
+	muxer   *oggopus.Muxer
+	stream  *oggopus.Stream
+
+	frame  []int16 // pcm which is not enough for the whole frame yet
+	packet []byte
+}
+
+func newOpusEncoder(out io.Writer, comments []string) (*opusEncoder, error) {
+	encoder, err := opus.NewEncoder(SampleRate, Channels, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create opus encoder: %w", err)
+	}
+
+	muxer := oggopus.NewMuxer(out)
+
+	stream, err := muxer.AddStream(
+		oggopus.Head{
+			Channels:        Channels,
+			PreSkip:         EncoderLookahead,
+			InputSampleRate: SampleRate,
+		},
+		oggopus.Tags{Comments: comments},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add opus stream: %w", err)
+	}
+
+	return &opusEncoder{
+		encoder: encoder,
+		muxer:   muxer,
+		stream:  stream,
+		frame:   make([]int16, 0, FrameSamples*Channels),
+		packet:  make([]byte, 4000),
+	}, nil
+}
+
+func (e *opusEncoder) Write(pcm []int16) error {
+	for len(pcm) > 0 {
+		n := min(len(pcm), cap(e.frame)-len(e.frame))
+
+		e.frame = append(e.frame, pcm[:n]...)
+		pcm = pcm[n:]
+
+		if len(e.frame) == cap(e.frame) {
+			if err := e.encodeFrame(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *opusEncoder) encodeFrame() error {
+	n, err := e.encoder.Encode(e.frame, e.packet)
+	if err != nil {
+		return fmt.Errorf("failed to encode opus frame: %w", err)
+	}
+
+	e.frame = e.frame[:0]
+
+	return e.stream.WritePacket(e.packet[:n])
+}
+
+func (e *opusEncoder) Close() error {
+	// last frame is padded with silence
+	if n := len(e.frame); n > 0 {
+		e.frame = e.frame[:cap(e.frame)]
+		clear(e.frame[n:])
+
+		if err := e.encodeFrame(); err != nil {
+			return err
+		}
+	}
+
+	return e.muxer.Close()
+}
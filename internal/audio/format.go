@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// fileTypes are content types of record files which are not audio of a single format.
+var fileTypes = map[string]string{
+	".mka":  "audio/x-matroska",
+	".webm": "audio/webm",
+	".m3u":  "audio/x-mpegurl",
+	".vtt":  "text/vtt; charset=utf-8",
+	".srt":  "application/x-subrip; charset=utf-8",
+	".json": "application/json",
+	".txt":  "text/plain; charset=utf-8",
+	".png":  "image/png",
+}
+
+// Format is a format of the record file.
+type Format string
+
+const (
+	FormatOpus Format = "ogg"
+	FormatWAV  Format = "wav"
+	FormatFLAC Format = "flac"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatOpus, FormatWAV, FormatFLAC:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown audio format: %q", value)
+	}
+}
+
+// FormatOf returns format of the file by its extension.
+func FormatOf(fileName string) (Format, bool) {
+	format, err := ParseFormat(strings.TrimPrefix(path.Ext(fileName), "."))
+	if err != nil {
+		return "", false
+	}
+
+	return format, true
+}
+
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatOpus:
+		return "audio/ogg"
+	case FormatWAV:
+		return "audio/wav"
+	case FormatFLAC:
+		return "audio/flac"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// ContentTypeOf returns content type of the record file by its extension.
+func ContentTypeOf(fileName string) string {
+	if format, found := FormatOf(fileName); found {
+		return format.ContentType()
+	}
+
+	if fileType, found := fileTypes[path.Ext(fileName)]; found {
+		return fileType
+	}
+
+	if mimeType := mime.TypeByExtension(path.Ext(fileName)); mimeType != "" {
+		return mimeType
+	}
+
+	return "application/octet-stream"
+}
@@ -0,0 +1,151 @@
+// Package autorecord decides when voice channels are recorded without the record command.
+package autorecord
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/kvizyx/voicelog/internal/config"
+)
+
+// Kind is a condition the channel is recorded on.
+type Kind string
+
+const (
+	// KindNewChannel records the channel when it is created.
+	KindNewChannel Kind = "new_channel"
+	// KindFirstJoin records the channel when the first human joins it.
+	KindFirstJoin Kind = "first_join"
+	// KindMinMembers records the channel when enough humans are in it.
+	KindMinMembers Kind = "min_members"
+	// KindRole records the channel when a member with any of the roles is in it.
+	KindRole Kind = "role"
+	// KindNever does not record channels automatically.
+	KindNever Kind = "never"
+)
+
+// Policy decides when voice channels of the guild are recorded automatically.
+type Policy struct {
+	kind       Kind
+	minMembers int
+	roles      []snowflake.ID
+	channels   []snowflake.ID // the only channels recorded, all if empty
+	ignored    []snowflake.ID // channels never recorded
+
+	scheduledEvents bool
+}
+
+// Channel is a state of the voice channel the policy is applied to.
+type Channel struct {
+	ID      snowflake.ID
+	Created bool     // whether the channel has just been created
+	Members []Member // humans in the channel
+
+	// Interrupted is whether recording of the channel has been interrupted by the restart,
+	// so it is picked up again as if the channel has just been created.
+	Interrupted bool
+}
+
+// Member is a human in the voice channel.
+type Member struct {
+	UserID  snowflake.ID
+	RoleIDs []snowflake.ID
+}
+
+// New returns policy made of the guild settings.
+func New(settings config.AutoRecord) (Policy, error) {
+	policy := Policy{
+		kind: Kind(settings.Policy),
+
+		scheduledEvents: settings.ScheduledEvents != nil && *settings.ScheduledEvents,
+	}
+
+	if settings.MinMembers != nil {
+		policy.minMembers = *settings.MinMembers
+	}
+
+	switch policy.kind {
+	case KindNewChannel, KindFirstJoin, KindNever:
+	case KindMinMembers:
+		if policy.minMembers < 1 {
+			return Policy{}, fmt.Errorf("invalid minimum number of members %d", policy.minMembers)
+		}
+	case KindRole:
+		if len(settings.Roles) == 0 {
+			return Policy{}, fmt.Errorf("no roles are set for %q policy", policy.kind)
+		}
+	default:
+		return Policy{}, fmt.Errorf("unknown auto record policy %q", settings.Policy)
+	}
+
+	var err error
+
+	if policy.roles, err = parseIDs(settings.Roles); err != nil {
+		return Policy{}, fmt.Errorf("invalid role: %w", err)
+	}
+
+	if policy.channels, err = parseIDs(settings.Channels); err != nil {
+		return Policy{}, fmt.Errorf("invalid channel: %w", err)
+	}
+
+	if policy.ignored, err = parseIDs(settings.IgnoredChannels); err != nil {
+		return Policy{}, fmt.Errorf("invalid ignored channel: %w", err)
+	}
+
+	return policy, nil
+}
+
+// ShouldRecord reports whether the channel has to be recorded.
+func (p Policy) ShouldRecord(channel Channel) bool {
+	if !p.allows(channel.ID) {
+		return false
+	}
+
+	switch p.kind {
+	case KindNewChannel:
+		return channel.Created || (channel.Interrupted && len(channel.Members) != 0)
+	case KindFirstJoin:
+		return len(channel.Members) != 0
+	case KindMinMembers:
+		return len(channel.Members) >= p.minMembers
+	case KindRole:
+		return slices.ContainsFunc(channel.Members, func(member Member) bool {
+			return slices.ContainsFunc(member.RoleIDs, func(roleID snowflake.ID) bool {
+				return slices.Contains(p.roles, roleID)
+			})
+		})
+	default:
+		return false
+	}
+}
+
+// RecordsScheduledEvent reports whether the channel has to be recorded while the scheduled
+// event in it is active.
+func (p Policy) RecordsScheduledEvent(channelID snowflake.ID) bool {
+	return p.scheduledEvents && p.allows(channelID)
+}
+
+// allows reports whether the channel may be recorded automatically.
+func (p Policy) allows(channelID snowflake.ID) bool {
+	if slices.Contains(p.ignored, channelID) {
+		return false
+	}
+
+	return len(p.channels) == 0 || slices.Contains(p.channels, channelID)
+}
+
+func parseIDs(values []string) ([]snowflake.ID, error) {
+	ids := make([]snowflake.ID, 0, len(values))
+
+	for _, value := range values {
+		id, err := snowflake.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
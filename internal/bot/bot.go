@@ -9,10 +9,13 @@ import (
 	"github.com/disgoorg/disgo/cache"
 	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/disgo/gateway"
+	"github.com/disgoorg/snowflake/v2"
 	eventhandler "github.com/kvizyx/voicelog/internal/bot/handler"
 	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
+	"github.com/kvizyx/voicelog/internal/bot/scheduler"
 	"github.com/kvizyx/voicelog/internal/config"
 	"github.com/kvizyx/voicelog/internal/storage/s3"
+	"github.com/kvizyx/voicelog/internal/transcription"
 	"github.com/kvizyx/voicelog/pkg/logger"
 )
 
@@ -20,6 +23,7 @@ type Bot struct {
 	config          config.Config
 	logger          logger.Logger
 	sessionsManager *recordsessions.SessionsManager
+	scheduler       *scheduler.Scheduler
 
 	s3storage *s3.Storage
 	botClient bot.Client
@@ -47,8 +51,9 @@ func (b *Bot) Start(ctx context.Context) error {
 			gateway.WithAutoReconnect(true),
 		),
 		bot.WithCacheConfigOpts(
-			// enables voice states caches to get access to old voice states
-			cache.WithCaches(cache.FlagVoiceStates),
+			// enables voice states caches to get access to old voice states, and members caches
+			// filled by voice state updates to know who is in the channel for auto record policies
+			cache.WithCaches(cache.FlagVoiceStates|cache.FlagMembers),
 		),
 	)
 	if err != nil {
@@ -57,34 +62,74 @@ func (b *Bot) Start(ctx context.Context) error {
 
 	b.botClient = botClient
 
+	transcriber, err := transcription.New(b.config.Transcription)
+	if err != nil {
+		return fmt.Errorf("failed to create transcriber: %w", err)
+	}
+
 	b.sessionsManager = recordsessions.NewManager(recordsessions.Params{
 		Logger:       b.logger,
 		S3Storage:    b.s3storage,
 		VoiceManager: b.botClient.VoiceManager(),
 		DiscordAPI:   b.botClient.Rest(),
+		Guilds:       b.config.Guilds,
+		Member:       botClient.Caches().Member,
+
+		StreamingUpload: b.config.StreamingUpload,
+		Transcriber:     transcriber,
 	})
 
 	handlerOpts := eventhandler.HandlerOptions{
 		Logger:          b.logger,
 		SessionsManager: b.sessionsManager,
+		Guilds:          b.config.Guilds,
+
+		ScheduledRecords: eventhandler.NewScheduledRecords(),
 	}
 
 	botClient.EventManager().AddEventListeners(&events.ListenerAdapter{
-		OnGuildChannelCreate: eventhandler.ChannelCreate(handlerOpts),
-		OnGuildVoiceJoin:     eventhandler.VoiceJoin(handlerOpts),
-		OnGuildVoiceLeave:    eventhandler.VoiceLeave(handlerOpts),
+		OnGuildReady:                    eventhandler.GuildReady(handlerOpts),
+		OnGuildChannelCreate:            eventhandler.ChannelCreate(handlerOpts),
+		OnGuildVoiceJoin:                eventhandler.VoiceJoin(handlerOpts),
+		OnGuildVoiceLeave:               eventhandler.VoiceLeave(handlerOpts),
+		OnApplicationCommandInteraction: eventhandler.RecordCommand(handlerOpts),
+		OnGuildScheduledEventCreate:     eventhandler.ScheduledEventCreate(handlerOpts),
+		OnGuildScheduledEventUpdate:     eventhandler.ScheduledEventUpdate(handlerOpts),
+		OnGuildScheduledEventDelete:     eventhandler.ScheduledEventDelete(handlerOpts),
 	})
 
+	_, err = b.botClient.Rest().SetGlobalCommands(b.botClient.ApplicationID(), eventhandler.Commands)
+	if err != nil {
+		return fmt.Errorf("failed to register application commands: %w", err)
+	}
+
+	// records of sessions interrupted by the crash are finished before new sessions can be spawned
+	b.sessionsManager.Recover(ctx, b.config.RecoveryNotice)
+
 	if err = b.botClient.OpenGateway(ctx); err != nil {
 		return fmt.Errorf("failed to connect to discord gateway: %w", err)
 	}
 
+	b.scheduler = scheduler.New(scheduler.Params{
+		Logger:          b.logger,
+		SessionsManager: b.sessionsManager,
+		Guilds:          b.config.Guilds,
+		Members: func(guildID, channelID snowflake.ID) []recordsessions.EventMemberJoin {
+			return eventhandler.ChannelMemberJoins(botClient, guildID, channelID)
+		},
+	})
+
+	if err = b.scheduler.Start(); err != nil {
+		return fmt.Errorf("failed to start recording schedules: %w", err)
+	}
+
 	b.logger.Info("discord bot started")
 
 	return nil
 }
 
 func (b *Bot) Stop(ctx context.Context) error {
+	b.scheduler.Stop()
 	b.sessionsManager.StopAll(ctx)
 	b.botClient.Close(ctx)
 
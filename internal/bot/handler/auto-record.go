@@ -0,0 +1,97 @@
+package eventhandler
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	autorecord "github.com/kvizyx/voicelog/internal/bot/auto-record"
+	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
+)
+
+// autoRecord starts recording the voice channel if auto record policy of the guild says so.
+// Channel is given with what triggered the check, its members are looked up here. Nothing
+// is started while another channel of the guild is recorded.
+func autoRecord(o HandlerOptions, client bot.Client, guildID snowflake.ID, channel autorecord.Channel) {
+	policy, err := autorecord.New(o.Guilds.Settings(guildID).AutoRecord)
+	if err != nil {
+		o.Logger.Error("invalid auto record policy", slog.Any("guild_id", guildID), slog.Any("error", err))
+		return
+	}
+
+	if _, err = o.SessionsManager.Status(guildID); err == nil {
+		return
+	}
+
+	members := channelMembers(client, guildID, channel.ID)
+
+	channel.Members = make([]autorecord.Member, 0, len(members))
+	for _, member := range members {
+		channel.Members = append(channel.Members, autorecord.Member{UserID: member.User.ID, RoleIDs: member.RoleIDs})
+	}
+
+	if !policy.ShouldRecord(channel) {
+		return
+	}
+
+	_, err = o.SessionsManager.Spawn(recordsessions.SpawnParams{
+		GuildID:   guildID,
+		ChannelID: channel.ID,
+		Members:   memberJoins(members),
+	})
+	if errors.Is(err, recordsessions.ErrAlreadyRecording) {
+		// another channel has been started concurrently
+		return
+	}
+
+	if err != nil {
+		o.Logger.Error("failed to spawn recording session", slog.Any("error", err))
+	}
+}
+
+// channelMembers returns humans which are in the voice channel. Members come from the cache,
+// where they are put by voice state updates, so the one missing there is only known by id.
+func channelMembers(client bot.Client, guildID, channelID snowflake.ID) []discord.Member {
+	members := make([]discord.Member, 0)
+
+	client.Caches().VoiceStatesForEach(guildID, func(voiceState discord.VoiceState) {
+		if voiceState.ChannelID == nil || *voiceState.ChannelID != channelID || voiceState.UserID == client.ID() {
+			return
+		}
+
+		member, found := client.Caches().Member(guildID, voiceState.UserID)
+		if !found {
+			member = discord.Member{GuildID: guildID, User: discord.User{ID: voiceState.UserID}}
+		}
+
+		if !member.User.Bot {
+			members = append(members, member)
+		}
+	})
+
+	return members
+}
+
+// ChannelMemberJoins returns join events of the humans which are in the voice channel, which are
+// given to the session spawned outside of the event handlers.
+func ChannelMemberJoins(client bot.Client, guildID, channelID snowflake.ID) []recordsessions.EventMemberJoin {
+	return memberJoins(channelMembers(client, guildID, channelID))
+}
+
+// memberJoins returns join events of the members, which are given to the spawned session.
+func memberJoins(members []discord.Member) []recordsessions.EventMemberJoin {
+	joins := make([]recordsessions.EventMemberJoin, 0, len(members))
+
+	for _, member := range members {
+		joins = append(joins, recordsessions.EventMemberJoin{
+			UserID:      member.User.ID,
+			DisplayName: member.EffectiveName(),
+			Time:        time.Now(),
+		})
+	}
+
+	return joins
+}
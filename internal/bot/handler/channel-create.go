@@ -1,10 +1,9 @@
 package eventhandler
 
 import (
-	"log/slog"
-
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
+	autorecord "github.com/kvizyx/voicelog/internal/bot/auto-record"
 )
 
 type ChannelCreateHandler func(event *events.GuildChannelCreate)
@@ -15,8 +14,6 @@ func ChannelCreate(o HandlerOptions) ChannelCreateHandler {
 			return
 		}
 
-		if err := o.SessionsManager.Spawn(event.GuildID, event.ChannelID); err != nil {
-			o.Logger.Error("failed to spawn recording session", slog.Any("error", err))
-		}
+		autoRecord(o, event.Client(), event.GuildID, autorecord.Channel{ID: event.ChannelID, Created: true})
 	}
 }
@@ -0,0 +1,66 @@
+package eventhandler
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+	autorecord "github.com/kvizyx/voicelog/internal/bot/auto-record"
+)
+
+type GuildReadyHandler func(event *events.GuildReady)
+
+// GuildReady picks recording up after the start, as members who are already in voice channels
+// do not join them again. Occupied channels of the guild are checked against its auto record
+// policy, as only one channel of the guild can be recorded, the channel which recording has
+// been interrupted goes first and the most crowded ones after it.
+func GuildReady(o HandlerOptions) GuildReadyHandler {
+	return func(event *events.GuildReady) {
+		guildID := event.Guild.ID
+		occupancy := make(map[snowflake.ID]int)
+
+		// only humans occupy channels, as in voice join and leave handlers
+		event.Client().Caches().VoiceStatesForEach(guildID, func(voiceState discord.VoiceState) {
+			if voiceState.ChannelID == nil || voiceState.UserID == event.Client().ID() {
+				return
+			}
+
+			if member, found := event.Client().Caches().Member(guildID, voiceState.UserID); found && member.User.Bot {
+				return
+			}
+
+			occupancy[*voiceState.ChannelID]++
+		})
+
+		channelIDs := make([]snowflake.ID, 0, len(occupancy))
+		for channelID := range occupancy {
+			channelIDs = append(channelIDs, channelID)
+		}
+
+		interrupted := make(map[snowflake.ID]bool, len(channelIDs))
+		for _, channelID := range channelIDs {
+			interrupted[channelID] = o.SessionsManager.Interrupted(channelID)
+		}
+
+		slices.SortFunc(channelIDs, func(a, b snowflake.ID) int {
+			if interrupted[a] != interrupted[b] {
+				if interrupted[a] {
+					return -1
+				}
+
+				return 1
+			}
+
+			return cmp.Compare(occupancy[b], occupancy[a])
+		})
+
+		for _, channelID := range channelIDs {
+			autoRecord(o, event.Client(), guildID, autorecord.Channel{
+				ID:          channelID,
+				Interrupted: interrupted[channelID],
+			})
+		}
+	}
+}
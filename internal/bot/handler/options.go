@@ -2,10 +2,14 @@ package eventhandler
 
 import (
 	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
+	"github.com/kvizyx/voicelog/internal/config"
 	"github.com/kvizyx/voicelog/pkg/logger"
 )
 
 type HandlerOptions struct {
 	Logger          logger.Logger
 	SessionsManager *recordsessions.SessionsManager
+	Guilds          config.Guilds
+
+	ScheduledRecords *ScheduledRecords
 }
@@ -0,0 +1,211 @@
+package eventhandler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
+)
+
+const recordCommandName = "record"
+
+// Commands are application commands handled by the bot.
+var Commands = []discord.ApplicationCommandCreate{
+	discord.SlashCommandCreate{
+		Name:        recordCommandName,
+		Description: "Record voice channel",
+		Contexts:    []discord.InteractionContextType{discord.InteractionContextTypeGuild},
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{Name: "start", Description: "Start recording your voice channel"},
+			discord.ApplicationCommandOptionSubCommand{Name: "stop", Description: "Stop recording and save the record"},
+			discord.ApplicationCommandOptionSubCommand{Name: "status", Description: "Show what is being recorded"},
+			discord.ApplicationCommandOptionSubCommand{Name: "pause", Description: "Pause recording"},
+			discord.ApplicationCommandOptionSubCommand{Name: "resume", Description: "Resume paused recording"},
+		},
+	},
+}
+
+type RecordCommandHandler func(event *events.ApplicationCommandInteractionCreate)
+
+// RecordCommand handles the record command. Recording can be started by those who can manage
+// channels of the guild or have any of its record roles, and controlled by members of the recorded
+// channel and by those who can manage channels, status is shown to anyone.
+func RecordCommand(o HandlerOptions) RecordCommandHandler {
+	return func(event *events.ApplicationCommandInteractionCreate) {
+		if event.Data.Type() != discord.ApplicationCommandTypeSlash || event.GuildID() == nil || event.Member() == nil {
+			return
+		}
+
+		data := event.SlashCommandInteractionData()
+		if data.CommandName() != recordCommandName || data.SubCommandName == nil {
+			return
+		}
+
+		guildID := *event.GuildID()
+
+		switch subcommand := *data.SubCommandName; subcommand {
+		case "start":
+			if !canStart(o, event, guildID) {
+				respond(o, event, "Only those who can manage channels or have a recording role can start the recording.")
+				return
+			}
+
+			startRecording(o, event, guildID)
+
+		case "status":
+			status, err := o.SessionsManager.Status(guildID)
+			if err != nil {
+				respond(o, event, commandErrorMessage(o, err))
+				return
+			}
+
+			respond(o, event, statusMessage(status))
+
+		case "stop", "pause", "resume":
+			status, err := o.SessionsManager.Status(guildID)
+			if err != nil {
+				respond(o, event, commandErrorMessage(o, err))
+				return
+			}
+
+			if !canControl(event, guildID, status.ChannelID) {
+				respond(o, event, fmt.Sprintf(
+					"Only members of <#%d> and those who can manage channels can %s the recording.",
+					status.ChannelID, subcommand,
+				))
+				return
+			}
+
+			controls := map[string]func(guildID snowflake.ID) error{
+				"stop":   o.SessionsManager.Stop,
+				"pause":  o.SessionsManager.Pause,
+				"resume": o.SessionsManager.Resume,
+			}
+
+			if err = controls[subcommand](guildID); err != nil {
+				respond(o, event, commandErrorMessage(o, err))
+				return
+			}
+
+			replies := map[string]string{
+				"stop":   "Recording is stopped, download links will be sent to the channel chat.",
+				"pause":  "Recording is paused, resume it with `/record resume`.",
+				"resume": "Recording is resumed.",
+			}
+
+			respond(o, event, replies[subcommand])
+		}
+	}
+}
+
+// startRecording starts recording voice channel of the member who invoked the command.
+func startRecording(o HandlerOptions, event *events.ApplicationCommandInteractionCreate, guildID snowflake.ID) {
+	voiceState, found := event.Client().Caches().VoiceState(guildID, event.Member().User.ID)
+	if !found || voiceState.ChannelID == nil {
+		respond(o, event, "Join a voice channel first, I record the one you are in.")
+		return
+	}
+
+	channelID := *voiceState.ChannelID
+
+	_, err := o.SessionsManager.Spawn(recordsessions.SpawnParams{
+		GuildID:   guildID,
+		ChannelID: channelID,
+		Members:   ChannelMemberJoins(event.Client(), guildID, channelID),
+	})
+	if err != nil {
+		respond(o, event, commandErrorMessage(o, err))
+		return
+	}
+
+	respond(o, event, fmt.Sprintf("Recording <#%d>, stop it with `/record stop`.", channelID))
+}
+
+// canStart reports whether the member who invoked the command may start recording.
+func canStart(o HandlerOptions, event *events.ApplicationCommandInteractionCreate, guildID snowflake.ID) bool {
+	member := event.Member()
+
+	if member.Permissions.Has(discord.PermissionManageChannels) {
+		return true
+	}
+
+	recordRoles := o.Guilds.Settings(guildID).RecordRoles
+
+	return slices.ContainsFunc(member.RoleIDs, func(roleID snowflake.ID) bool {
+		return slices.Contains(recordRoles, roleID.String())
+	})
+}
+
+// canControl reports whether the member who invoked the command may control recording of the channel.
+func canControl(event *events.ApplicationCommandInteractionCreate, guildID, channelID snowflake.ID) bool {
+	member := event.Member()
+
+	if member.Permissions.Has(discord.PermissionManageChannels) {
+		return true
+	}
+
+	voiceState, found := event.Client().Caches().VoiceState(guildID, member.User.ID)
+
+	return found && voiceState.ChannelID != nil && *voiceState.ChannelID == channelID
+}
+
+func statusMessage(status recordsessions.Status) string {
+	var message strings.Builder
+
+	if status.Title != "" {
+		fmt.Fprintf(&message, "**%s**: ", status.Title)
+	}
+
+	fmt.Fprintf(&message, "Recording <#%d> since <t:%d:R>", status.ChannelID, status.StartedAt.Unix())
+
+	if status.Part > 1 {
+		fmt.Fprintf(&message, ", part %d", status.Part)
+	}
+
+	switch {
+	case status.Stopping:
+		message.WriteString(", it is stopping now.")
+	case status.Paused:
+		message.WriteString(", it is paused.")
+	default:
+		fmt.Fprintf(&message, ", %d members in the channel.", status.Members)
+	}
+
+	return message.String()
+}
+
+// commandErrorMessage returns message explaining why the command has failed.
+func commandErrorMessage(o HandlerOptions, err error) string {
+	switch {
+	case errors.Is(err, recordsessions.ErrNotRecording):
+		return "Nothing is being recorded on this server."
+	case errors.Is(err, recordsessions.ErrAlreadyRecording):
+		return "A voice channel of this server is already being recorded, stop it with `/record stop` first."
+	case errors.Is(err, recordsessions.ErrStopping):
+		return "Recording is stopping, download links will be sent to the channel chat."
+	case errors.Is(err, recordsessions.ErrAlreadyPaused):
+		return "Recording is already paused."
+	case errors.Is(err, recordsessions.ErrNotPaused):
+		return "Recording is not paused."
+	default:
+		o.Logger.Error("failed to handle record command", slog.Any("error", err))
+		return "Something went wrong, try again later."
+	}
+}
+
+// respond responds to the command with a message only the member who invoked it can see.
+func respond(o HandlerOptions, event *events.ApplicationCommandInteractionCreate, content string) {
+	err := event.CreateMessage(discord.MessageCreate{
+		Content: content,
+		Flags:   discord.MessageFlagEphemeral,
+	})
+	if err != nil {
+		o.Logger.Error("failed to respond to the command", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,140 @@
+package eventhandler
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
+	autorecord "github.com/kvizyx/voicelog/internal/bot/auto-record"
+	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
+)
+
+type (
+	ScheduledEventCreateHandler func(event *events.GuildScheduledEventCreate)
+	ScheduledEventUpdateHandler func(event *events.GuildScheduledEventUpdate)
+	ScheduledEventDeleteHandler func(event *events.GuildScheduledEventDelete)
+)
+
+// ScheduledRecords remembers records started by the scheduled events, so the ended event
+// stops only the recording it has started.
+type ScheduledRecords struct {
+	records map[snowflake.ID]uuid.UUID // first record of the session by scheduled event id
+	mu      sync.Mutex
+}
+
+func NewScheduledRecords() *ScheduledRecords {
+	return &ScheduledRecords{records: make(map[snowflake.ID]uuid.UUID)}
+}
+
+func (r *ScheduledRecords) add(eventID snowflake.ID, recordID uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[eventID] = recordID
+}
+
+// take returns the record started by the scheduled event and forgets it.
+func (r *ScheduledRecords) take(eventID snowflake.ID) (uuid.UUID, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recordID, found := r.records[eventID]
+	delete(r.records, eventID)
+
+	return recordID, found
+}
+
+func ScheduledEventCreate(o HandlerOptions) ScheduledEventCreateHandler {
+	return func(event *events.GuildScheduledEventCreate) {
+		if event.GuildScheduled.Status == discord.ScheduledEventStatusActive {
+			startScheduledEvent(o, event.Client(), event.GuildScheduled)
+		}
+	}
+}
+
+// ScheduledEventUpdate starts recording when the scheduled event starts and stops it when
+// the event ends.
+func ScheduledEventUpdate(o HandlerOptions) ScheduledEventUpdateHandler {
+	return func(event *events.GuildScheduledEventUpdate) {
+		switch event.GuildScheduled.Status {
+		case discord.ScheduledEventStatusActive:
+			// event is updated while active too, it is started only once
+			if event.OldGuildScheduled.Status != discord.ScheduledEventStatusActive {
+				startScheduledEvent(o, event.Client(), event.GuildScheduled)
+			}
+
+		case discord.ScheduledEventStatusCompleted, discord.ScheduledEventStatusCancelled:
+			stopScheduledEvent(o, event.GuildScheduled)
+		}
+	}
+}
+
+func ScheduledEventDelete(o HandlerOptions) ScheduledEventDeleteHandler {
+	return func(event *events.GuildScheduledEventDelete) {
+		stopScheduledEvent(o, event.GuildScheduled)
+	}
+}
+
+// startScheduledEvent records voice or stage channel of the scheduled event, titling the record
+// after the event, if the guild records scheduled events.
+func startScheduledEvent(o HandlerOptions, client bot.Client, scheduled discord.GuildScheduledEvent) {
+	// external events have no channel
+	if scheduled.ChannelID == nil {
+		return
+	}
+
+	policy, err := autorecord.New(o.Guilds.Settings(scheduled.GuildID).AutoRecord)
+	if err != nil {
+		o.Logger.Error("invalid auto record policy", slog.Any("guild_id", scheduled.GuildID), slog.Any("error", err))
+		return
+	}
+
+	if !policy.RecordsScheduledEvent(*scheduled.ChannelID) {
+		return
+	}
+
+	recordID, err := o.SessionsManager.Spawn(recordsessions.SpawnParams{
+		GuildID:   scheduled.GuildID,
+		ChannelID: *scheduled.ChannelID,
+		Members:   ChannelMemberJoins(client, scheduled.GuildID, *scheduled.ChannelID),
+		Title:     scheduled.Name,
+	})
+	if errors.Is(err, recordsessions.ErrAlreadyRecording) {
+		o.Logger.Info(
+			"guild is already recorded, scheduled event is not",
+			slog.Any("guild_id", scheduled.GuildID),
+			slog.Any("scheduled_event_id", scheduled.ID),
+		)
+		return
+	}
+
+	if err != nil {
+		o.Logger.Error("failed to spawn recording session", slog.Any("error", err))
+		return
+	}
+
+	o.ScheduledRecords.add(scheduled.ID, recordID)
+}
+
+// stopScheduledEvent stops recording of the ended scheduled event. Recording of its channel
+// started otherwise is left alone.
+func stopScheduledEvent(o HandlerOptions, scheduled discord.GuildScheduledEvent) {
+	recordID, found := o.ScheduledRecords.take(scheduled.ID)
+	if !found {
+		return
+	}
+
+	status, err := o.SessionsManager.Status(scheduled.GuildID)
+	if err != nil || status.FirstRecordID != recordID {
+		return
+	}
+
+	if err = o.SessionsManager.Stop(scheduled.GuildID); err != nil && !errors.Is(err, recordsessions.ErrStopping) {
+		o.Logger.Error("failed to stop recording session", slog.Any("error", err))
+	}
+}
@@ -2,8 +2,10 @@ package eventhandler
 
 import (
 	"log/slog"
+	"time"
 
 	"github.com/disgoorg/disgo/events"
+	autorecord "github.com/kvizyx/voicelog/internal/bot/auto-record"
 	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
 )
 
@@ -24,6 +26,12 @@ func VoiceJoin(o HandlerOptions) VoiceJoinHandler {
 			return
 		}
 
-		o.SessionsManager.SendEvent(*channelID, recordsessions.EventMemberJoin{})
+		o.SessionsManager.SendEvent(*channelID, recordsessions.EventMemberJoin{
+			UserID:      event.Member.User.ID,
+			DisplayName: event.Member.EffectiveName(),
+			Time:        time.Now(),
+		})
+
+		autoRecord(o, event.Client(), event.VoiceState.GuildID, autorecord.Channel{ID: *channelID})
 	}
 }
@@ -2,6 +2,7 @@ package eventhandler
 
 import (
 	"log/slog"
+	"time"
 
 	"github.com/disgoorg/disgo/events"
 	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
@@ -24,6 +25,10 @@ func VoiceLeave(o HandlerOptions) VoiceLeaveHandler {
 			return
 		}
 
-		o.SessionsManager.SendEvent(*channelID, recordsessions.EventMemberLeave{})
+		o.SessionsManager.SendEvent(*channelID, recordsessions.EventMemberLeave{
+			UserID:      event.Member.User.ID,
+			DisplayName: event.Member.EffectiveName(),
+			Time:        time.Now(),
+		})
 	}
 }
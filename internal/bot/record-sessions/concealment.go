@@ -0,0 +1,83 @@
+package recordsessions
+
+import (
+	"fmt"
+
+	"github.com/disgoorg/disgo/voice"
+	"gopkg.in/hraban/opus.v2"
+)
+
+// maxConcealedPackets is how many packets lost in a row are synthesized. Longer losses
+// are left as silence, since extrapolated audio turns into noise quickly.
+const maxConcealedPackets = 5
+
+// concealLoss synthesizes audio of the packets lost right before the packet and writes it
+// to the track and into the mix. The last lost packet is recovered from in-band FEC data of
+// the packet where the sender has provided it, the others are concealed by the decoder.
+func (s *Session) concealLoss(userTrack *track, packet receivedPacket, position int64) error {
+	// decoder knows nothing to extrapolate from until the first packet is decoded
+	if packet.lost == 0 || packet.lost > maxConcealedPackets || userTrack.packetSamples == 0 {
+		return nil
+	}
+
+	samples := userTrack.packetSamples
+
+	for i := 0; i < packet.lost; i++ {
+		pcm, err := userTrack.concealPacket(packet.Packet, i == packet.lost-1)
+		if err != nil {
+			return err
+		}
+
+		lostPosition := position - int64((packet.lost-i)*samples)
+
+		if err = userTrack.writeConcealed(pcm, lostPosition); err != nil {
+			return err
+		}
+
+		userTrack.dynamics.process(pcm)
+		s.mixer.add(lostPosition, pcm)
+
+		userTrack.stats.Concealed++
+	}
+
+	return nil
+}
+
+// concealPacket synthesizes pcm of the lost packet preceding the next one. If fec is set,
+// in-band FEC data of the next packet is used, falling back to the packet loss concealment.
+func (t *track) concealPacket(next *voice.Packet, fec bool) ([]int16, error) {
+	pcm := t.pcm[:t.packetSamples*channelsCount]
+
+	if fec {
+		if err := t.decoder.DecodeFEC(next.Opus, pcm); err == nil {
+			return pcm, nil
+		}
+	}
+
+	if err := t.decoder.DecodePLC(pcm); err != nil {
+		return nil, fmt.Errorf("failed to conceal lost packet: %w", err)
+	}
+
+	return pcm, nil
+}
+
+// writeConcealed encodes synthesized pcm and writes it to the track, since the track keeps
+// packets as they have been received and there is no original packet for it.
+func (t *track) writeConcealed(pcm []int16, position int64) error {
+	if t.encoder == nil {
+		encoder, err := opus.NewEncoder(sampleRate, channelsCount, opus.AppVoIP)
+		if err != nil {
+			return fmt.Errorf("failed to create opus encoder: %w", err)
+		}
+
+		t.encoder = encoder
+		t.encoded = make([]byte, 4000)
+	}
+
+	n, err := t.encoder.Encode(pcm, t.encoded)
+	if err != nil {
+		return fmt.Errorf("failed to encode concealed packet: %w", err)
+	}
+
+	return t.writePacket(t.encoded[:n], position, len(pcm)/channelsCount)
+}
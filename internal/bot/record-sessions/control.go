@@ -0,0 +1,80 @@
+package recordsessions
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
+)
+
+// Status is a state of the recording session reported to the members.
+type Status struct {
+	ChannelID snowflake.ID
+	Title     string
+	StartedAt time.Time // when the session has been spawned
+	RecordID  uuid.UUID // current record of the session
+	// first record of the session, which identifies the session when the record is split into parts
+	FirstRecordID uuid.UUID
+	Part          int
+	Paused        bool
+	Stopping      bool
+	Members       int
+}
+
+// Status returns current state of the session.
+func (s *Session) Status() Status {
+	s.statusMu.Lock()
+	status := s.status
+	s.statusMu.Unlock()
+
+	status.Paused = s.paused.Load()
+	status.Stopping = s.stopping.Load()
+	status.Members = int(s.channelMembers.Load())
+
+	return status
+}
+
+// setRecordStatus updates status with the record which has been started.
+func (s *Session) setRecordStatus(recordID uuid.UUID, part int) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	s.status.RecordID = recordID
+	s.status.Part = part
+}
+
+// pause stops recording audio until resume is called. Timeline of the record keeps running,
+// so the pause is left as silence. It reports whether the session has not been paused before.
+func (s *Session) pause() bool {
+	s.tracksMu.Lock()
+	defer s.tracksMu.Unlock()
+
+	if !s.paused.CompareAndSwap(false, true) {
+		return false
+	}
+
+	// audio received before the pause is still recorded
+	if err := s.releasePackets(time.Now()); err != nil {
+		s.logger.Debug("failed to write packet data to file", slog.Any("error", err))
+	}
+
+	// streams received after the pause do not continue the buffered ones
+	clear(s.jitterBuffers)
+	clear(s.pendingPackets)
+
+	s.logger.Info("voice recording paused")
+
+	return true
+}
+
+// resume continues recording paused session. It reports whether the session has been paused.
+func (s *Session) resume() bool {
+	if !s.paused.CompareAndSwap(true, false) {
+		return false
+	}
+
+	s.logger.Info("voice recording resumed")
+
+	return true
+}
@@ -0,0 +1,132 @@
+package recordsessions
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// speakersName is a base name of the speaker timeline files, which are written in every
+// of speakerFormats.
+const speakersName = "speakers"
+
+var speakerFormats = []string{".vtt", ".srt", ".json"}
+
+// speakerCue is a time when the participant has been speaking.
+type speakerCue struct {
+	Start  float64      `json:"start"` // offset from the beginning of the record (in seconds)
+	End    float64      `json:"end"`   // in seconds
+	UserID snowflake.ID `json:"user_id"`
+	Name   string       `json:"name"`
+}
+
+// speakerTimeline lists who spoke when in the record.
+type speakerTimeline struct {
+	RecordID string       `json:"record_id"`
+	Cues     []speakerCue `json:"cues"`
+}
+
+// writeSpeakerTimeline writes who spoke when in the record as WebVTT and SRT captions and
+// as JSON. It reports whether the timeline is written, which it is not if nobody spoke.
+func (s *Session) writeSpeakerTimeline(ctx context.Context, participants []participantMetadata) (bool, error) {
+	names := make(map[snowflake.ID]string, len(participants))
+	for _, participant := range participants {
+		names[participant.UserID] = participant.Name
+	}
+
+	cues := make([]speakerCue, 0)
+
+	for _, userTrack := range s.tracks {
+		for _, span := range userTrack.speech.spans {
+			cues = append(cues, speakerCue{
+				Start:  float64(span[0]) / sampleRate,
+				End:    float64(span[1]) / sampleRate,
+				UserID: userTrack.userID,
+				Name:   names[userTrack.userID],
+			})
+		}
+	}
+
+	// speech of the recovered record is not known
+	if len(cues) == 0 {
+		return false, nil
+	}
+
+	slices.SortFunc(cues, func(a, b speakerCue) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	timeline, err := json.MarshalIndent(speakerTimeline{RecordID: s.recordID.String(), Cues: cues}, "", "  ")
+	if err != nil {
+		return false, err
+	}
+
+	files := map[string][]byte{
+		".vtt":  makeWebVTT(cues),
+		".srt":  makeSRT(cues),
+		".json": timeline,
+	}
+
+	for _, extension := range speakerFormats {
+		if err = s.writeRecordData(ctx, speakersName+extension, files[extension]); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// makeWebVTT makes WebVTT captions with speaker name as the text of the cue.
+func makeWebVTT(cues []speakerCue) []byte {
+	var captions strings.Builder
+
+	captions.WriteString("WEBVTT\n")
+
+	for _, cue := range cues {
+		fmt.Fprintf(
+			&captions, "\n%s --> %s\n<v %s>%s\n",
+			formatCueTime(cue.Start, "."), formatCueTime(cue.End, "."),
+			escapeCueText(cue.Name), escapeCueText(cue.Name),
+		)
+	}
+
+	return []byte(captions.String())
+}
+
+// makeSRT makes SubRip captions with speaker name as the text of the cue.
+func makeSRT(cues []speakerCue) []byte {
+	var captions strings.Builder
+
+	for i, cue := range cues {
+		fmt.Fprintf(
+			&captions, "%d\n%s --> %s\n%s\n\n",
+			i+1, formatCueTime(cue.Start, ","), formatCueTime(cue.End, ","), cue.Name,
+		)
+	}
+
+	return []byte(captions.String())
+}
+
+// formatCueTime formats offset (in seconds) as "hh:mm:ss" followed by milliseconds after
+// the separator, which is "." in WebVTT and "," in SRT.
+func formatCueTime(offset float64, separator string) string {
+	milliseconds := (time.Duration(offset*1000+0.5) * time.Millisecond).Milliseconds()
+
+	return fmt.Sprintf(
+		"%02d:%02d:%02d%s%03d",
+		milliseconds/3_600_000, milliseconds/60_000%60, milliseconds/1000%60,
+		separator, milliseconds%1000,
+	)
+}
+
+var cueTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeCueText(text string) string {
+	return cueTextEscaper.Replace(text)
+}
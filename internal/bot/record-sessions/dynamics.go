@@ -0,0 +1,148 @@
+package recordsessions
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// gateRange is how much the closed noise gate attenuates the audio (in dB).
+	gateRange = -40.0
+	// gateHold is how long the gate stays open after the audio falls below the threshold,
+	// so quiet endings of words are not cut off.
+	gateHold    = 200 * time.Millisecond
+	gateAttack  = 5 * time.Millisecond
+	gateRelease = 100 * time.Millisecond
+
+	// agcWindow is how long the speaker level is averaged over to adjust the gain.
+	agcWindow = 1 * time.Second
+	// agcSmoothing is how fast the gain follows the speaker level.
+	agcSmoothing = 50 * time.Millisecond
+	// minAGCGain and maxAGCGain (in dB) bound the gain, so loud speakers are attenuated and
+	// quiet ones are amplified, but their noise is not.
+	minAGCGain = -12.0
+	maxAGCGain = 18.0
+	// agcMinLevel (in dBFS) is the lowest level of the audio which is taken into account
+	// by AGC without the gate, so pauses do not drive the gain up.
+	agcMinLevel = -50.0
+)
+
+// speakerDynamics evens out the volume of the speaker and mutes the noise between phrases
+// before the audio is mixed, so a single noisy or loud participant does not dominate the mix.
+type speakerDynamics struct {
+	gateThreshold float64 // RMS level (linear) below which the gate closes, zero disables the gate
+	agcTarget     float64 // RMS level (linear) of the speech AGC aims for, zero disables AGC
+
+	gateGain    float64 // current gain of the gate, from gateRange to 1
+	holdSamples int64   // samples left before the gate starts closing
+	level       float64 // RMS level (linear) of the speech averaged over agcWindow
+	agcGain     float64 // current gain of AGC
+}
+
+// newSpeakerDynamics creates processor with the gate threshold and AGC target given in
+// dBFS. Any of them is disabled if zero.
+func newSpeakerDynamics(gateThreshold, agcTarget float64) *speakerDynamics {
+	d := &speakerDynamics{
+		gateGain: 1,
+		agcGain:  1,
+	}
+
+	if gateThreshold != 0 {
+		d.gateThreshold = fromDecibels(gateThreshold)
+	}
+	if agcTarget != 0 {
+		d.agcTarget = fromDecibels(agcTarget)
+	}
+
+	return d
+}
+
+func (d *speakerDynamics) enabled() bool {
+	return d.gateThreshold != 0 || d.agcTarget != 0
+}
+
+// process applies the gate and AGC to interleaved stereo pcm in place.
+func (d *speakerDynamics) process(pcm []int16) {
+	samples := int64(len(pcm) / channelsCount)
+	if samples == 0 || !d.enabled() {
+		return
+	}
+
+	level := rmsLevel(pcm)
+
+	gateTarget := 1.0
+	if d.gateThreshold != 0 {
+		if level >= d.gateThreshold {
+			d.holdSamples = durationSamples(gateHold)
+		}
+
+		if d.holdSamples <= 0 {
+			gateTarget = fromDecibels(gateRange)
+		}
+	}
+
+	agcTarget := d.agcGain
+	if d.agcTarget != 0 {
+		speaking := level >= fromDecibels(agcMinLevel)
+		if d.gateThreshold != 0 {
+			speaking = level >= d.gateThreshold
+		}
+
+		if speaking {
+			if d.level == 0 {
+				d.level = level
+			} else {
+				d.level += (level - d.level) * smoothing(samples, agcWindow)
+			}
+		}
+
+		if d.level != 0 {
+			agcTarget = max(fromDecibels(minAGCGain), min(fromDecibels(maxAGCGain), d.agcTarget/d.level))
+		}
+	}
+
+	var (
+		attack  = smoothing(1, gateAttack)
+		release = smoothing(1, gateRelease)
+		follow  = smoothing(1, agcSmoothing)
+	)
+
+	for i := int64(0); i < samples; i++ {
+		if gateTarget > d.gateGain {
+			d.gateGain += (gateTarget - d.gateGain) * attack
+		} else {
+			d.gateGain += (gateTarget - d.gateGain) * release
+		}
+
+		d.agcGain += (agcTarget - d.agcGain) * follow
+
+		gain := d.gateGain * d.agcGain
+		for c := 0; c < channelsCount; c++ {
+			sample := float64(pcm[i*channelsCount+int64(c)]) * gain
+			pcm[i*channelsCount+int64(c)] = int16(max(math.MinInt16, min(math.MaxInt16, sample)))
+		}
+	}
+
+	d.holdSamples -= samples
+}
+
+// rmsLevel returns RMS level of interleaved pcm relative to the full scale.
+func rmsLevel(pcm []int16) float64 {
+	var energy float64
+	for _, sample := range pcm {
+		value := float64(sample) / math.MaxInt16
+		energy += value * value
+	}
+
+	return math.Sqrt(energy / float64(len(pcm)))
+}
+
+// smoothing returns coefficient of exponential smoothing with given time constant for
+// the step of given number of samples.
+func smoothing(samples int64, timeConstant time.Duration) float64 {
+	return 1 - math.Exp(-float64(samples)/float64(durationSamples(timeConstant)))
+}
+
+func fromDecibels(value float64) float64 {
+	return math.Pow(10, value/20)
+}
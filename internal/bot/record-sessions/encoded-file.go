@@ -0,0 +1,66 @@
+package recordsessions
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/kvizyx/voicelog/internal/audio"
+)
+
+// encodedFile is a local record file which pcm is encoded into.
+type encodedFile struct {
+	name   string // name of the file within the record
+	format audio.Format
+
+	file    io.WriteCloser
+	encoder audio.Encoder
+}
+
+func newEncodedFile(
+	createFile createFileFunc,
+	baseName string,
+	format audio.Format,
+	comments []string,
+) (*encodedFile, error) {
+	name := baseName + format.Extension()
+
+	file, err := createFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	encoder, err := audio.NewEncoder(format, file, comments...)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to create %s encoder: %w", format, err)
+	}
+
+	return &encodedFile{
+		name:    name,
+		format:  format,
+		file:    file,
+		encoder: encoder,
+	}, nil
+}
+
+func (f *encodedFile) write(pcm []int16) error {
+	return f.encoder.Write(pcm)
+}
+
+// finish encodes buffered pcm. File has to be closed after that.
+func (f *encodedFile) finish() error {
+	return f.encoder.Close()
+}
+
+// close closes the file. In streaming mode it waits for the file upload to complete.
+func (f *encodedFile) close() error {
+	// files of the recovered segments are closed by the interrupted session
+	if f.file == nil {
+		return nil
+	}
+
+	file := f.file
+	f.file = nil
+
+	return file.Close()
+}
@@ -1,22 +1,43 @@
 package recordsessions
 
 import (
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
 	"github.com/kvizyx/cycle"
 )
 
 const (
 	EventTypeMemberJoin cycle.EventType = iota
 	EventTypeMemberLeave
+	EventTypeDurationLimit
 )
 
-type EventMemberJoin struct{}
+// EventMemberJoin is sent when the member joins the voice channel of the session.
+type EventMemberJoin struct {
+	UserID      snowflake.ID
+	DisplayName string
+	Time        time.Time
+}
 
 func (e EventMemberJoin) Type() cycle.EventType {
 	return EventTypeMemberJoin
 }
 
-type EventMemberLeave struct{}
+// EventMemberLeave is sent when the member leaves the voice channel of the session.
+type EventMemberLeave struct {
+	UserID      snowflake.ID
+	DisplayName string
+	Time        time.Time
+}
 
 func (e EventMemberLeave) Type() cycle.EventType {
 	return EventTypeMemberLeave
 }
+
+// EventDurationLimit is sent when the record reaches maximum duration.
+type EventDurationLimit struct{}
+
+func (e EventDurationLimit) Type() cycle.EventType {
+	return EventTypeDurationLimit
+}
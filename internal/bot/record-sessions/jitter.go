@@ -0,0 +1,197 @@
+package recordsessions
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+const statsName = "stats.json"
+
+const (
+	// jitterDelay is how long packets wait for the missing packets before them.
+	jitterDelay = 60 * time.Millisecond
+	// maxJitterPackets is how many packets may be buffered while waiting for the missing ones.
+	maxJitterPackets = 16
+
+	// maxSequenceJump is the largest difference between sequence numbers of the packets
+	// which are considered to belong to the same continuous stream.
+	maxSequenceJump = 1000
+	// historySize is how many released sequence numbers are remembered to detect duplicates.
+	historySize = 64
+)
+
+// packetStats are statistics of the packets received from the participant.
+type packetStats struct {
+	Received   int `json:"received"`
+	Lost       int `json:"lost"`
+	Late       int `json:"late"` // arrived after they have been considered lost
+	Duplicates int `json:"duplicates"`
+	Reordered  int `json:"reordered"` // arrived out of order, but in time to be put in place
+	Concealed  int `json:"concealed"` // lost packets which audio has been synthesized
+}
+
+// recordStats are statistics of the packets received during the record.
+type recordStats struct {
+	Participants map[string]packetStats `json:"participants"` // by user id
+}
+
+func (s *packetStats) add(other packetStats) {
+	s.Received += other.Received
+	s.Lost += other.Lost
+	s.Late += other.Late
+	s.Duplicates += other.Duplicates
+	s.Reordered += other.Reordered
+	s.Concealed += other.Concealed
+}
+
+// jitterBuffer reorders packets of a single SSRC by their sequence numbers. Packets are
+// released in order, and missing ones are waited for jitterDelay before they are considered lost.
+type jitterBuffer struct {
+	packets []receivedPacket // buffered packets in order of their sequence numbers
+	next    uint16           // sequence number of the next packet to release
+	history uint64           // bit i is set if packet with sequence number next-1-i has been released
+	started bool
+
+	stats packetStats
+}
+
+// push adds received packet to the buffer. If the packet breaks the sequence, the stream
+// is considered restarted and packets buffered before are returned to be released at once.
+func (b *jitterBuffer) push(packet receivedPacket) []receivedPacket {
+	b.stats.Received++
+
+	if !b.started {
+		b.started = true
+		b.next = packet.Sequence
+	}
+
+	var flushed []receivedPacket
+
+	diff := b.offset(packet.Sequence)
+
+	switch {
+	case diff < -maxSequenceJump || diff > maxSequenceJump:
+		flushed = b.packets
+		b.packets = nil
+		b.next = packet.Sequence
+		b.history = 0
+		diff = 0
+
+	case diff < 0:
+		if -diff <= historySize && b.history&(1<<(-diff-1)) != 0 {
+			b.stats.Duplicates++
+			return nil
+		}
+
+		b.stats.Late++
+		if -diff <= historySize {
+			b.stats.Lost--
+			b.history |= 1 << (-diff - 1)
+		}
+
+		return nil
+	}
+
+	i := len(b.packets)
+	for i > 0 && b.offset(b.packets[i-1].Sequence) >= diff {
+		i--
+	}
+
+	if i < len(b.packets) {
+		if b.packets[i].Sequence == packet.Sequence {
+			b.stats.Duplicates++
+			return flushed
+		}
+
+		b.stats.Reordered++
+	}
+
+	b.packets = append(b.packets, receivedPacket{})
+	copy(b.packets[i+1:], b.packets[i:])
+	b.packets[i] = packet
+
+	return flushed
+}
+
+// release returns buffered packets which are in order. Missing packets are considered lost,
+// if packets after them have arrived before the deadline or the buffer is full.
+func (b *jitterBuffer) release(deadline time.Time) []receivedPacket {
+	var released []receivedPacket
+
+	for len(b.packets) > 0 {
+		first := b.packets[0]
+
+		if gap := b.offset(first.Sequence); gap > 0 {
+			if first.arrivedAt.After(deadline) && len(b.packets) <= maxJitterPackets {
+				break
+			}
+
+			b.stats.Lost += gap
+			b.history <<= min(gap, historySize)
+			b.next = first.Sequence
+
+			first.lost = gap
+		}
+
+		released = append(released, first)
+		b.packets = b.packets[1:]
+
+		b.history = b.history<<1 | 1
+		b.next++
+	}
+
+	return released
+}
+
+// takeStats returns statistics gathered since the previous call.
+func (b *jitterBuffer) takeStats() packetStats {
+	stats := b.stats
+	b.stats = packetStats{}
+
+	return stats
+}
+
+// offset returns difference between sequence number and the next one to release,
+// taking wraparound into account.
+func (b *jitterBuffer) offset(sequence uint16) int {
+	return int(int16(sequence - b.next))
+}
+
+// writeStats writes packet statistics of all participants of the record.
+func (s *Session) writeStats(ctx context.Context) error {
+	stats := recordStats{Participants: make(map[string]packetStats, len(s.tracks))}
+	total := packetStats{}
+
+	for _, userTrack := range s.tracks {
+		stats.Participants[userTrack.userID.String()] = userTrack.stats
+		total.add(userTrack.stats)
+	}
+
+	// tracks of the recovered record have no statistics
+	if total.Received == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = s.writeRecordData(ctx, statsName, data); err != nil {
+		return err
+	}
+
+	s.logger.Info(
+		"packet statistics of the record",
+		slog.Int("received", total.Received),
+		slog.Int("lost", total.Lost),
+		slog.Int("late", total.Late),
+		slog.Int("duplicates", total.Duplicates),
+		slog.Int("reordered", total.Reordered),
+		slog.Int("concealed", total.Concealed),
+	)
+
+	return nil
+}
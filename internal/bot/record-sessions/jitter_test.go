@@ -0,0 +1,235 @@
+package recordsessions
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/voice"
+)
+
+var jitterStart = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+// arrival is a packet arriving at the offset from the start.
+type arrival struct {
+	sequence uint16
+	at       time.Duration
+}
+
+func pushArrivals(b *jitterBuffer, arrivals ...arrival) []receivedPacket {
+	var flushed []receivedPacket
+
+	for _, a := range arrivals {
+		packet := receivedPacket{
+			Packet:    &voice.Packet{Sequence: a.sequence},
+			arrivedAt: jitterStart.Add(a.at),
+		}
+
+		flushed = append(flushed, b.push(packet)...)
+	}
+
+	return flushed
+}
+
+func releaseAt(b *jitterBuffer, now time.Duration) []receivedPacket {
+	return b.release(jitterStart.Add(now - jitterDelay))
+}
+
+func sequences(packets []receivedPacket) []uint16 {
+	result := make([]uint16, 0, len(packets))
+	for _, packet := range packets {
+		result = append(result, packet.Sequence)
+	}
+
+	return result
+}
+
+func TestJitterBufferReorder(t *testing.T) {
+	tests := []struct {
+		name      string
+		arrivals  []arrival
+		released  []uint16
+		reordered int
+	}{
+		{
+			name:     "in order",
+			arrivals: []arrival{{10, 0}, {11, 20 * time.Millisecond}, {12, 40 * time.Millisecond}},
+			released: []uint16{10, 11, 12},
+		},
+		{
+			name:      "swapped",
+			arrivals:  []arrival{{10, 0}, {12, 20 * time.Millisecond}, {11, 25 * time.Millisecond}},
+			released:  []uint16{10, 11, 12},
+			reordered: 1,
+		},
+		{
+			name:      "reversed",
+			arrivals:  []arrival{{10, 0}, {13, 20 * time.Millisecond}, {12, 25 * time.Millisecond}, {11, 30 * time.Millisecond}},
+			released:  []uint16{10, 11, 12, 13},
+			reordered: 2,
+		},
+		{
+			name:      "sequence wraparound",
+			arrivals:  []arrival{{65534, 0}, {0, 20 * time.Millisecond}, {65535, 25 * time.Millisecond}, {1, 40 * time.Millisecond}},
+			released:  []uint16{65534, 65535, 0, 1},
+			reordered: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b jitterBuffer
+
+			if flushed := pushArrivals(&b, tt.arrivals...); len(flushed) != 0 {
+				t.Fatalf("flushed %v", sequences(flushed))
+			}
+
+			released := releaseAt(&b, time.Second)
+			if !slices.Equal(sequences(released), tt.released) {
+				t.Errorf("released %v, want %v", sequences(released), tt.released)
+			}
+
+			for _, packet := range released {
+				if packet.lost != 0 {
+					t.Errorf("packet %d follows %d lost ones", packet.Sequence, packet.lost)
+				}
+			}
+
+			want := packetStats{Received: len(tt.arrivals), Reordered: tt.reordered}
+			if stats := b.takeStats(); stats != want {
+				t.Errorf("stats = %+v, want %+v", stats, want)
+			}
+		})
+	}
+}
+
+func TestJitterBufferWaitsForMissing(t *testing.T) {
+	var b jitterBuffer
+
+	pushArrivals(&b, arrival{10, 0}, arrival{12, 20 * time.Millisecond})
+
+	// packet after the gap waits for the missing one until jitter delay passes
+	if released := releaseAt(&b, 30*time.Millisecond); !slices.Equal(sequences(released), []uint16{10}) {
+		t.Fatalf("released %v before the deadline, want [10]", sequences(released))
+	}
+
+	released := releaseAt(&b, 20*time.Millisecond+jitterDelay+time.Millisecond)
+	if !slices.Equal(sequences(released), []uint16{12}) {
+		t.Fatalf("released %v after the deadline, want [12]", sequences(released))
+	}
+
+	if released[0].lost != 1 {
+		t.Errorf("packet 12 follows %d lost ones, want 1", released[0].lost)
+	}
+
+	if stats := b.takeStats(); stats != (packetStats{Received: 2, Lost: 1}) {
+		t.Errorf("stats = %+v, want 1 lost", stats)
+	}
+
+	// lost packet arriving late is not released and is not counted as lost anymore
+	if released = append(pushArrivals(&b, arrival{11, 200 * time.Millisecond}), releaseAt(&b, time.Second)...); len(released) != 0 {
+		t.Errorf("late packet is released: %v", sequences(released))
+	}
+
+	if stats := b.takeStats(); stats != (packetStats{Received: 1, Lost: -1, Late: 1}) {
+		t.Errorf("stats = %+v, want late packet moved from lost", stats)
+	}
+
+	// and it is a duplicate when it arrives once again
+	pushArrivals(&b, arrival{11, 300 * time.Millisecond})
+
+	if stats := b.takeStats(); stats != (packetStats{Received: 1, Duplicates: 1}) {
+		t.Errorf("stats = %+v, want duplicate", stats)
+	}
+}
+
+func TestJitterBufferFull(t *testing.T) {
+	var b jitterBuffer
+
+	pushArrivals(&b, arrival{0, 0})
+
+	// packets after the gap are released before the deadline once the buffer overflows
+	for sequence := uint16(2); sequence < 2+maxJitterPackets+1; sequence++ {
+		pushArrivals(&b, arrival{sequence, 10 * time.Millisecond})
+	}
+
+	released := releaseAt(&b, 20*time.Millisecond)
+	if len(released) != maxJitterPackets+2 {
+		t.Fatalf("released %d packets, want %d", len(released), maxJitterPackets+2)
+	}
+
+	if released[1].Sequence != 2 || released[1].lost != 1 {
+		t.Errorf("packet after the gap is %d following %d lost, want 2 following 1", released[1].Sequence, released[1].lost)
+	}
+}
+
+func TestJitterBufferDuplicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		arrivals []arrival
+		release  bool // release packets before the last arrival
+		released []uint16
+	}{
+		{
+			name:     "buffered",
+			arrivals: []arrival{{10, 0}, {11, 0}, {11, 5 * time.Millisecond}},
+			released: []uint16{10, 11},
+		},
+		{
+			name:     "released",
+			arrivals: []arrival{{10, 0}, {11, 0}, {10, 5 * time.Millisecond}},
+			release:  true,
+		},
+		{
+			name:     "buffered after the gap",
+			arrivals: []arrival{{10, 0}, {13, 0}, {13, 5 * time.Millisecond}},
+			released: []uint16{10, 13},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b jitterBuffer
+
+			last := len(tt.arrivals) - 1
+
+			pushArrivals(&b, tt.arrivals[:last]...)
+			if tt.release {
+				releaseAt(&b, time.Second)
+			}
+
+			pushArrivals(&b, tt.arrivals[last])
+
+			if released := releaseAt(&b, time.Second); !slices.Equal(sequences(released), tt.released) {
+				t.Errorf("released %v, want %v", sequences(released), tt.released)
+			}
+
+			if stats := b.takeStats(); stats.Duplicates != 1 || stats.Received != len(tt.arrivals) {
+				t.Errorf("stats = %+v, want 1 duplicate of %d received", stats, len(tt.arrivals))
+			}
+		})
+	}
+}
+
+func TestJitterBufferRestart(t *testing.T) {
+	var b jitterBuffer
+
+	pushArrivals(&b, arrival{100, 0}, arrival{102, 0})
+
+	// jump of the sequence numbers flushes packets of the previous stream
+	flushed := pushArrivals(&b, arrival{30000, 10 * time.Millisecond})
+	if !slices.Equal(sequences(flushed), []uint16{100, 102}) {
+		t.Errorf("flushed %v, want [100 102]", sequences(flushed))
+	}
+
+	pushArrivals(&b, arrival{30001, 20 * time.Millisecond})
+
+	released := releaseAt(&b, 20*time.Millisecond)
+	if !slices.Equal(sequences(released), []uint16{30000, 30001}) {
+		t.Errorf("released %v, want [30000 30001]", sequences(released))
+	}
+
+	if stats := b.takeStats(); stats.Lost != 0 {
+		t.Errorf("%d packets are lost across the restart", stats.Lost)
+	}
+}
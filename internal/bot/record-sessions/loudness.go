@@ -0,0 +1,123 @@
+package recordsessions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/kvizyx/voicelog/internal/audio"
+	"github.com/kvizyx/voicelog/pkg/loudness"
+)
+
+const loudnessName = "loudness.json"
+
+// maxNormalizationGain is the largest gain (in dB) applied to the quiet track, so almost
+// silent tracks are not turned into loud noise.
+const maxNormalizationGain = 20.0
+
+// loudnessReport is loudness of the participant tracks measured before normalization.
+type loudnessReport struct {
+	Target        float64                  `json:"target"`          // in LUFS
+	TruePeakLimit float64                  `json:"true_peak_limit"` // in dBTP
+	Tracks        map[string]trackLoudness `json:"tracks"`          // by user id
+}
+
+type trackLoudness struct {
+	Integrated float64 `json:"integrated"` // in LUFS
+	TruePeak   float64 `json:"true_peak"`  // in dBTP
+	Gain       float64 `json:"gain"`       // applied to the track (in dB)
+
+	// loudness and true peak of the track with the gain applied, integrated loudness is
+	// below the target when the gain is constrained by the true peak limit or maxNormalizationGain
+	Achieved         float64 `json:"achieved"`           // in LUFS
+	AchievedTruePeak float64 `json:"achieved_true_peak"` // in dBTP
+	PeakConstrained  bool    `json:"peak_constrained"`
+}
+
+// normalizationGains measures integrated loudness of every participant track and returns gains
+// (Q7.8 dB) bringing them to the target loudness. Gain is peak-constrained: audio is not limited,
+// instead the gain is reduced where needed to keep the true peak within the limit, so such a track
+// stays quieter than the target. Loudness it reaches is reported along with the target. Gain is
+// set as the output gain of the track stream, so the audio is not re-encoded.
+func (s *Session) normalizationGains(ctx context.Context) (map[snowflake.ID]int16, error) {
+	gains := make(map[snowflake.ID]int16, len(s.tracks))
+
+	report := loudnessReport{
+		Target:        s.loudnessTarget,
+		TruePeakLimit: s.truePeakLimit,
+		Tracks:        make(map[string]trackLoudness, len(s.tracks)),
+	}
+
+	for _, userTrack := range s.tracks {
+		integrated, truePeak, err := s.measureTrack(ctx, userTrack.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure loudness of the track: %w", err)
+		}
+
+		// nothing is loud enough to be measured
+		if math.IsInf(integrated, -1) {
+			continue
+		}
+
+		targetGain := s.loudnessTarget - integrated
+		peakGain := s.truePeakLimit - truePeak
+
+		gain := min(targetGain, peakGain, maxNormalizationGain)
+		outputGain := int16(math.Round(gain * 256))
+		appliedGain := float64(outputGain) / 256
+
+		gains[userTrack.userID] = outputGain
+		report.Tracks[userTrack.userID.String()] = trackLoudness{
+			Integrated:       integrated,
+			TruePeak:         truePeak,
+			Gain:             appliedGain,
+			Achieved:         integrated + appliedGain,
+			AchievedTruePeak: truePeak + appliedGain,
+			PeakConstrained:  peakGain < targetGain && peakGain < maxNormalizationGain,
+		}
+
+		s.logger.Debug(
+			"participant track loudness measured",
+			slog.Any("user_id", userTrack.userID),
+			slog.Float64("integrated", integrated),
+			slog.Float64("true_peak", truePeak),
+			slog.Float64("gain", appliedGain),
+			slog.Float64("achieved", integrated+appliedGain),
+		)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.writeRecordData(ctx, loudnessName, data); err != nil {
+		return nil, err
+	}
+
+	return gains, nil
+}
+
+// measureTrack returns integrated loudness (in LUFS) and true peak (in dBTP) of the track.
+func (s *Session) measureTrack(ctx context.Context, name string) (float64, float64, error) {
+	in, err := s.openRecordFile(ctx, name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close() // nolint: errcheck
+
+	meter := loudness.NewMeter(sampleRate, channelsCount)
+
+	err = audio.Decode(in, func(pcm []int16) error {
+		meter.Write(pcm)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return meter.Integrated(), meter.TruePeak(), nil
+}
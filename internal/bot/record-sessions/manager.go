@@ -2,22 +2,43 @@ package recordsessions
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
+	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/rest"
 	"github.com/disgoorg/disgo/voice"
 	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
 	"github.com/kvizyx/cycle"
+	"github.com/kvizyx/voicelog/internal/audio"
+	"github.com/kvizyx/voicelog/internal/config"
 	"github.com/kvizyx/voicelog/internal/storage/s3"
+	"github.com/kvizyx/voicelog/internal/transcription"
 	"github.com/kvizyx/voicelog/pkg/logger"
 )
 
+var (
+	ErrAlreadyRecording = errors.New("voice channel of the guild is already recorded")
+	ErrNotRecording     = errors.New("nothing is recorded in the guild")
+	ErrStopping         = errors.New("recording session is stopping")
+	ErrAlreadyPaused    = errors.New("recording is already paused")
+	ErrNotPaused        = errors.New("recording is not paused")
+)
+
 type SessionsManager struct {
 	Params
 
 	sessions map[SessionID]*Session
 	mu       *sync.RWMutex
+
+	interrupted map[snowflake.ID]struct{} // channels which recording has been recovered after the crash
+
+	transcriptions     *transcriptionQueue // nil if records are not transcribed
+	stopTranscriptions context.CancelFunc
 }
 
 type Params struct {
@@ -25,34 +46,144 @@ type Params struct {
 	S3Storage    *s3.Storage
 	VoiceManager voice.Manager
 	DiscordAPI   rest.Rest
+	Guilds       config.Guilds
+
+	// Member returns guild member from the cache, it tells bots apart from humans.
+	Member func(guildID, userID snowflake.ID) (discord.Member, bool)
+
+	// StreamingUpload enables upload of record files while they are written, instead of
+	// keeping them on the local disk until the session stops.
+	StreamingUpload bool
+
+	// Transcriber transcribes records when they are finished. Records are not transcribed if nil.
+	Transcriber transcription.Transcriber
 }
 
 func NewManager(params Params) *SessionsManager {
-	return &SessionsManager{
+	sm := &SessionsManager{
 		Params: params,
 
 		sessions: make(map[SessionID]*Session),
 		mu:       &sync.RWMutex{},
+
+		interrupted: make(map[snowflake.ID]struct{}),
+	}
+
+	if params.Transcriber != nil {
+		var ctx context.Context
+		ctx, sm.stopTranscriptions = context.WithCancel(context.Background())
+
+		sm.transcriptions = newTranscriptionQueue(params.Logger)
+		go sm.transcriptions.run(ctx)
 	}
+
+	return sm
 }
 
-func (sm *SessionsManager) Spawn(guildID, channelID snowflake.ID) error {
+// SpawnParams describe the voice channel to record.
+type SpawnParams struct {
+	GuildID   snowflake.ID
+	ChannelID snowflake.ID
+
+	// Members which are already in the channel, so the session knows when it becomes empty.
+	Members []EventMemberJoin
+
+	// Title of the record, it is made of the guild and channel names if empty.
+	Title string
+}
+
+// Spawn starts recording the voice channel. Only one channel of the guild can be recorded
+// at a time, as the bot has a single voice connection per guild. It returns id of the first
+// record of the session, which is reported as Status.FirstRecordID.
+func (sm *SessionsManager) Spawn(params SpawnParams) (uuid.UUID, error) {
+	guildID, channelID := params.GuildID, params.ChannelID
+
 	sessionLogger := sm.Logger.With(
 		slog.Any("guild_id", guildID),
 		slog.Any("channel_id", channelID),
 	)
 
+	settings := sm.Guilds.Settings(guildID)
+
+	formats := make([]audio.Format, 0, len(settings.Formats))
+	for _, value := range settings.Formats {
+		format, err := audio.ParseFormat(value)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("invalid guild settings: %w", err)
+		}
+
+		formats = append(formats, format)
+	}
+
+	multitrack, err := parseMultitrack(settings.Multitrack)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid guild settings: %w", err)
+	}
+
+	limitAction, err := parseLimitAction(settings.OnMaxDuration)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid guild settings: %w", err)
+	}
+
+	firstRecordID, err := uuid.NewRandom()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to generate id for voice record: %w", err)
+	}
+
 	session := &Session{
 		logger:        sessionLogger,
-		voiceUploader: sm.S3Storage,
+		recordStorage: sm.S3Storage,
 		voiceManager:  sm.VoiceManager,
 		discordAPI:    sm.DiscordAPI,
+		member:        sm.Member,
+		streaming:     sm.StreamingUpload,
 
 		guildID:   guildID,
 		channelID: channelID,
+		title:     params.Title,
+		formats:   formats,
+		roster:    newRoster(),
+
+		segmentDuration: settings.SegmentDuration,
+
+		multitrack: multitrack,
+
+		maxDuration: *settings.MaxDuration,
+		limitAction: limitAction,
+
+		trimSilence: *settings.TrimSilence,
+
+		loudnessTarget: *settings.LoudnessTarget,
+		truePeakLimit:  *settings.TruePeakLimit,
+
+		noiseGate:      *settings.NoiseGate,
+		autoGainTarget: *settings.AutoGainTarget,
+
+		transcriber:    sm.Transcriber,
+		transcriptions: sm.transcriptions,
+
+		firstRecordID: firstRecordID,
+
+		status: Status{
+			ChannelID:     channelID,
+			Title:         params.Title,
+			StartedAt:     time.Now(),
+			FirstRecordID: firstRecordID,
+		},
+	}
+
+	for _, member := range params.Members {
+		session.roster.join(member.UserID, member.DisplayName, member.Time)
 	}
 
+	session.channelMembers.Store(uint32(len(params.Members)))
+	session.channelNotEmpty.Store(len(params.Members) != 0)
+
 	sm.mu.Lock()
+	if _, found := sm.guildSession(guildID); found {
+		sm.mu.Unlock()
+		return uuid.Nil, ErrAlreadyRecording
+	}
 	sm.sessions[channelID] = session
 	sm.mu.Unlock()
 
@@ -68,7 +199,7 @@ func (sm *SessionsManager) Spawn(guildID, channelID snowflake.ID) error {
 		}
 	}()
 
-	return nil
+	return firstRecordID, nil
 }
 
 // SendEvent send event to session with given id.
@@ -84,7 +215,112 @@ func (sm *SessionsManager) SendEvent(channelID SessionID, event cycle.Event) {
 	session.cycle.SendEvent(event)
 }
 
-// StopAll stop all voice recording sessions gracefully.
+// Status returns state of the session recording voice channel of the guild.
+func (sm *SessionsManager) Status(guildID snowflake.ID) (Status, error) {
+	session, err := sm.findSession(guildID)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return session.Status(), nil
+}
+
+// Stop stops the session recording voice channel of the guild. Record is published in background.
+func (sm *SessionsManager) Stop(guildID snowflake.ID) error {
+	session, err := sm.findSession(guildID)
+	if err != nil {
+		return err
+	}
+
+	if !session.stopping.CompareAndSwap(false, true) {
+		return ErrStopping
+	}
+
+	go func() {
+		if err := session.cycle.Stop(context.Background()); err != nil {
+			sm.Logger.Error(
+				"failed to stop recording session gracefully",
+				slog.Any("error", err),
+			)
+		}
+	}()
+
+	return nil
+}
+
+// Pause pauses recording of the guild voice channel, the pause is left as silence in the record.
+func (sm *SessionsManager) Pause(guildID snowflake.ID) error {
+	session, err := sm.findSession(guildID)
+	if err != nil {
+		return err
+	}
+
+	if session.stopping.Load() {
+		return ErrStopping
+	}
+
+	if !session.pause() {
+		return ErrAlreadyPaused
+	}
+
+	return nil
+}
+
+// Resume resumes paused recording of the guild voice channel.
+func (sm *SessionsManager) Resume(guildID snowflake.ID) error {
+	session, err := sm.findSession(guildID)
+	if err != nil {
+		return err
+	}
+
+	if session.stopping.Load() {
+		return ErrStopping
+	}
+
+	if !session.resume() {
+		return ErrNotPaused
+	}
+
+	return nil
+}
+
+// Interrupted reports whether recording of the channel has been interrupted by the crash
+// of the process, and its record has been recovered on this start.
+func (sm *SessionsManager) Interrupted(channelID snowflake.ID) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	_, found := sm.interrupted[channelID]
+
+	return found
+}
+
+// findSession returns the session recording voice channel of the guild.
+func (sm *SessionsManager) findSession(guildID snowflake.ID) (*Session, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, found := sm.guildSession(guildID)
+	if !found {
+		return nil, ErrNotRecording
+	}
+
+	return session, nil
+}
+
+// guildSession returns the session of the guild. It must be called with the lock held.
+func (sm *SessionsManager) guildSession(guildID snowflake.ID) (*Session, bool) {
+	for _, session := range sm.sessions {
+		if session.guildID == guildID {
+			return session, true
+		}
+	}
+
+	return nil, false
+}
+
+// StopAll stop all voice recording sessions gracefully. Transcription of the records which
+// is not done yet is canceled.
 func (sm *SessionsManager) StopAll(ctx context.Context) {
 	wg := &sync.WaitGroup{}
 
@@ -103,4 +339,9 @@ func (sm *SessionsManager) StopAll(ctx context.Context) {
 	}
 
 	wg.Wait()
+
+	if sm.transcriptions != nil {
+		sm.stopTranscriptions()
+		sm.transcriptions.wait()
+	}
 }
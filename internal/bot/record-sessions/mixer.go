@@ -0,0 +1,294 @@
+package recordsessions
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kvizyx/voicelog/internal/audio"
+)
+
+const (
+	sampleRate      = audio.SampleRate
+	channelsCount   = audio.Channels
+	frameSamples    = audio.FrameSamples
+	maxFrameSamples = sampleRate / 1000 * 120
+
+	trimmedMixName = "mix-trimmed"
+
+	// mixLatency is how long mixer waits for late audio before encoding the part of timeline.
+	mixLatency = 500 * time.Millisecond
+)
+
+// mixer sums decoded audio of all participants on the shared timeline of the session
+// and encodes the result into the mix files of every requested format. Mix is split into
+// segments of fixed duration, every finished segment is handed to onSegment.
+//
+// If trimming is enabled, the mix is also encoded as a whole into the trimmed files, where
+// silence is cut to trimFrames.
+type mixer struct {
+	createFile    createFileFunc
+	formats       []audio.Format
+	segmentFrames int64
+	segment       *mixSegment // segment being encoded, nil until the first frame of it
+	onSegment     func(segment *mixSegment)
+	comments      func() []string // comments of the mix files, made when the file is created
+
+	frames       map[int64][]int32  // summed frames which are not encoded yet by index on the timeline
+	speechFrames map[int64]struct{} // frames which are not encoded yet and contain speech
+	nextFrame    int64              // index of the first frame which is not encoded yet
+	endFrame     int64              // index of the frame following the last one with any audio
+	speech       speechActivity     // speech of anyone on the encoded part of the timeline
+
+	trimFrames   int64 // longest silence in the trimmed mix, zero disables it
+	trimmed      []*encodedFile
+	silentFrames int64 // number of frames since the last one containing speech
+
+	pcm []int16
+}
+
+// mixSegment is a part of the mix encoded into separate files.
+type mixSegment struct {
+	index      int
+	startFrame int64 // index of the first frame of the segment on the timeline
+	frames     int64 // number of frames encoded into the segment
+	outputs    []*encodedFile
+}
+
+func newMixer(
+	createFile createFileFunc,
+	formats []audio.Format,
+	segmentDuration time.Duration,
+	trimSilence time.Duration,
+	comments func() []string,
+	onSegment func(segment *mixSegment),
+) *mixer {
+	return &mixer{
+		createFile:    createFile,
+		formats:       formats,
+		segmentFrames: max(1, durationSamples(segmentDuration)/frameSamples),
+		onSegment:     onSegment,
+		comments:      comments,
+		frames:        make(map[int64][]int32),
+		speechFrames:  make(map[int64]struct{}),
+		trimFrames:    durationSamples(trimSilence) / frameSamples,
+		pcm:           make([]int16, frameSamples*channelsCount),
+	}
+}
+
+// add mixes interleaved stereo pcm into the timeline starting at given position (in samples).
+// Audio which falls into already encoded part of the timeline is dropped.
+func (m *mixer) add(position int64, pcm []int16) {
+	for i := 0; i < len(pcm)/channelsCount; i++ {
+		sample := position + int64(i)
+		if sample < 0 {
+			continue
+		}
+
+		frameIndex := sample / frameSamples
+		if frameIndex < m.nextFrame {
+			continue
+		}
+
+		frame, found := m.frames[frameIndex]
+		if !found {
+			frame = make([]int32, frameSamples*channelsCount)
+			m.frames[frameIndex] = frame
+		}
+
+		offset := int(sample%frameSamples) * channelsCount
+		for c := 0; c < channelsCount; c++ {
+			frame[offset+c] += int32(pcm[i*channelsCount+c])
+		}
+
+		m.endFrame = max(m.endFrame, frameIndex+1)
+	}
+}
+
+// markSpeech marks frames of the timeline overlapped by given part (in samples) as containing speech.
+func (m *mixer) markSpeech(position int64, samples int64) {
+	for frameIndex := max(0, position) / frameSamples; frameIndex*frameSamples < position+samples; frameIndex++ {
+		if frameIndex >= m.nextFrame {
+			m.speechFrames[frameIndex] = struct{}{}
+		}
+	}
+}
+
+// flush encodes all frames of the timeline before given position (in samples) which
+// will not receive audio anymore. Frames without any audio are encoded as silence.
+func (m *mixer) flush(position int64) error {
+	untilFrame := min(position/frameSamples, m.endFrame)
+
+	for ; m.nextFrame < untilFrame; m.nextFrame++ {
+		frame := m.frames[m.nextFrame]
+		delete(m.frames, m.nextFrame)
+
+		_, speech := m.speechFrames[m.nextFrame]
+		delete(m.speechFrames, m.nextFrame)
+
+		if speech {
+			m.speech.add(m.nextFrame*frameSamples, (m.nextFrame+1)*frameSamples)
+		}
+
+		for i := range m.pcm {
+			if frame == nil {
+				m.pcm[i] = 0
+				continue
+			}
+
+			m.pcm[i] = int16(max(math.MinInt16, min(math.MaxInt16, frame[i])))
+		}
+
+		if err := m.writeFrame(); err != nil {
+			return err
+		}
+
+		if err := m.writeTrimmed(speech); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFrame encodes mixed pcm as the next frame, starting new segment if the current one is full.
+func (m *mixer) writeFrame() error {
+	if m.segment != nil && m.segment.frames == m.segmentFrames {
+		if err := m.finishSegment(); err != nil {
+			return err
+		}
+	}
+
+	if m.segment == nil {
+		if err := m.startSegment(); err != nil {
+			return err
+		}
+	}
+
+	for _, output := range m.segment.outputs {
+		if err := output.write(m.pcm); err != nil {
+			return fmt.Errorf("failed to encode mixed frame into %s: %w", output.format, err)
+		}
+	}
+
+	m.segment.frames++
+
+	return nil
+}
+
+// writeTrimmed encodes mixed pcm into the trimmed mix, unless the frame is a part of
+// the silence which has already lasted longer than allowed.
+func (m *mixer) writeTrimmed(speech bool) error {
+	if m.trimFrames == 0 {
+		return nil
+	}
+
+	if speech {
+		m.silentFrames = 0
+	} else {
+		m.silentFrames++
+	}
+
+	if m.silentFrames > m.trimFrames {
+		return nil
+	}
+
+	if m.trimmed == nil {
+		trimmed := make([]*encodedFile, 0, len(m.formats))
+		comments := m.comments()
+
+		for _, format := range m.formats {
+			output, err := newEncodedFile(m.createFile, trimmedMixName, format, comments)
+			if err != nil {
+				for _, created := range trimmed {
+					_ = created.finish()
+					_ = created.close()
+				}
+
+				return fmt.Errorf("failed to create trimmed mix file: %w", err)
+			}
+
+			trimmed = append(trimmed, output)
+		}
+
+		m.trimmed = trimmed
+	}
+
+	for _, output := range m.trimmed {
+		if err := output.write(m.pcm); err != nil {
+			return fmt.Errorf("failed to encode trimmed frame into %s: %w", output.format, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *mixer) startSegment() error {
+	index := int(m.nextFrame / m.segmentFrames)
+
+	segment := &mixSegment{
+		index:      index,
+		startFrame: m.nextFrame,
+		outputs:    make([]*encodedFile, 0, len(m.formats)),
+	}
+
+	comments := m.comments()
+
+	for _, format := range m.formats {
+		output, err := newEncodedFile(m.createFile, fmt.Sprintf("segments/mix-%03d", index), format, comments)
+		if err != nil {
+			for _, created := range segment.outputs {
+				_ = created.finish()
+				_ = created.close()
+			}
+
+			return fmt.Errorf("failed to create mix segment file: %w", err)
+		}
+
+		segment.outputs = append(segment.outputs, output)
+	}
+
+	m.segment = segment
+
+	return nil
+}
+
+func (m *mixer) finishSegment() error {
+	segment := m.segment
+	m.segment = nil
+
+	for _, output := range segment.outputs {
+		if err := output.finish(); err != nil {
+			return fmt.Errorf("failed to finish %s mix segment file: %w", output.format, err)
+		}
+	}
+
+	// files are closed by the receiver of the segment, as closing of the streamed file
+	// waits for its upload
+	m.onSegment(segment)
+
+	return nil
+}
+
+// close encodes the rest of the timeline, finishes the last segment and closes the trimmed mix.
+func (m *mixer) close() error {
+	if err := m.flush(m.endFrame * frameSamples); err != nil {
+		return err
+	}
+
+	for _, output := range m.trimmed {
+		if err := output.finish(); err != nil {
+			return fmt.Errorf("failed to finish %s trimmed mix file: %w", output.format, err)
+		}
+
+		if err := output.close(); err != nil {
+			return fmt.Errorf("failed to close %s trimmed mix file: %w", output.format, err)
+		}
+	}
+
+	if m.segment == nil {
+		return nil
+	}
+
+	return m.finishSegment()
+}
@@ -0,0 +1,213 @@
+package recordsessions
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/kvizyx/voicelog/pkg/matroska"
+	oggopus "github.com/kvizyx/voicelog/pkg/ogg-opus"
+)
+
+// multitrackExtensions are extensions of the multitrack file by its container.
+var multitrackExtensions = map[matroska.DocType]string{
+	matroska.DocTypeMatroska: ".mka",
+	matroska.DocTypeWebM:     ".webm",
+}
+
+// multitrackContainers are containers of the multitrack file by their names in guild settings.
+var multitrackContainers = map[string]matroska.DocType{
+	"mka":  matroska.DocTypeMatroska,
+	"webm": matroska.DocTypeWebM,
+}
+
+// parseMultitrack parses container of the multitrack file from guild settings. Empty
+// container means that multitrack file is not written.
+func parseMultitrack(value string) (matroska.DocType, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	docType, found := multitrackContainers[value]
+	if !found {
+		return "", fmt.Errorf("unknown multitrack container %q", value)
+	}
+
+	return docType, nil
+}
+
+// writeMultitrack writes all participant tracks into a single multitrack file and
+// returns its name within the record.
+func (s *Session) writeMultitrack(ctx context.Context) (string, error) {
+	name := "tracks" + multitrackExtensions[s.multitrack]
+
+	sources := make([]*multitrackSource, 0, len(s.tracks))
+	duration := int64(0)
+
+	defer func() {
+		for _, source := range sources {
+			_ = source.in.Close()
+		}
+	}()
+
+	for _, userTrack := range s.tracks {
+		in, err := s.openRecordFile(ctx, userTrack.name)
+		if err != nil {
+			return "", fmt.Errorf("failed to open track: %w", err)
+		}
+
+		sources = append(sources, &multitrackSource{
+			name: s.memberName(ctx, userTrack.userID),
+			in:   in,
+		})
+
+		duration = max(duration, userTrack.nextPosition)
+	}
+
+	slices.SortFunc(sources, func(a, b *multitrackSource) int {
+		return cmp.Compare(a.name, b.name)
+	})
+
+	out, err := s.createRecordFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multitrack file: %w", err)
+	}
+
+	if err = remuxTracks(out, s.multitrack, samplesDuration(duration), sources); err != nil {
+		_ = out.Close()
+		return "", err
+	}
+
+	if err = out.Close(); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// memberName returns name of the guild member as it is displayed in discord, falling
+// back to the user id if member can not be fetched.
+func (s *Session) memberName(ctx context.Context, userID snowflake.ID) string {
+	member, err := s.discordAPI.GetMember(s.guildID, userID, rest.WithCtx(ctx))
+	if err != nil {
+		s.logger.Debug("failed to get guild member", slog.Any("user_id", userID), slog.Any("error", err))
+		return userID.String()
+	}
+
+	return member.EffectiveName()
+}
+
+// multitrackSource is a participant track remuxed into the multitrack file.
+type multitrackSource struct {
+	name string        // name of the participant
+	in   io.ReadCloser // Ogg Opus track
+
+	reader   *oggopus.Reader
+	packet   oggopus.Packet
+	position int64 // position of the next packet in the track (in samples)
+	done     bool
+}
+
+// next reads next packet of the track.
+func (s *multitrackSource) next() error {
+	if s.packet.Data != nil {
+		samples, err := oggopus.PacketSamples(s.packet.Data)
+		if err != nil {
+			return err
+		}
+
+		s.position += int64(samples)
+	}
+
+	packet, err := s.reader.ReadPacket()
+	if errors.Is(err, io.EOF) {
+		s.done = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.packet = packet
+
+	return nil
+}
+
+// remuxTracks remuxes participant tracks into a single Matroska (or WebM) file with
+// a separate Opus track named after every participant.
+func remuxTracks(
+	out io.Writer,
+	docType matroska.DocType,
+	duration time.Duration,
+	sources []*multitrackSource,
+) error {
+	tracks := make([]matroska.Track, 0, len(sources))
+
+	for _, source := range sources {
+		source.reader = oggopus.NewReader(source.in)
+
+		if err := source.next(); err != nil {
+			return fmt.Errorf("failed to read track: %w", err)
+		}
+
+		head, found := source.reader.Head(source.packet.Serial)
+		if !found {
+			return fmt.Errorf("failed to read track: %w", oggopus.ErrInvalidHeader)
+		}
+
+		tracks = append(tracks, matroska.Track{
+			Name:       source.name,
+			Head:       head.Marshal(),
+			CodecDelay: samplesDuration(int64(head.PreSkip)),
+			SampleRate: sampleRate,
+			Channels:   uint64(head.Channels),
+		})
+	}
+
+	writer, err := matroska.NewWriter(out, matroska.Header{
+		DocType:  docType,
+		Duration: duration,
+		Tracks:   tracks,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		// blocks of all tracks are interleaved in order of their timestamps
+		next := -1
+		for i, source := range sources {
+			if !source.done && (next == -1 || source.position < sources[next].position) {
+				next = i
+			}
+		}
+
+		if next == -1 {
+			break
+		}
+
+		source := sources[next]
+
+		if err = writer.WriteBlock(next+1, samplesDuration(source.position), source.packet.Data); err != nil {
+			return fmt.Errorf("failed to write block: %w", err)
+		}
+
+		if err = source.next(); err != nil {
+			return fmt.Errorf("failed to read track: %w", err)
+		}
+	}
+
+	return writer.Close()
+}
+
+// samplesDuration returns duration of given number of samples (per channel).
+func samplesDuration(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / sampleRate
+}
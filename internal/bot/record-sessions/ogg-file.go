@@ -0,0 +1,51 @@
+package recordsessions
+
+import (
+	"fmt"
+	"io"
+
+	oggopus "github.com/kvizyx/voicelog/pkg/ogg-opus"
+)
+
+// oggFile is a local Ogg Opus file with a single stereo stream.
+type oggFile struct {
+	file   io.WriteCloser
+	muxer  *oggopus.Muxer
+	stream *oggopus.Stream
+}
+
+func newOggFile(file io.WriteCloser, preSkip uint16, comments []string) (*oggFile, error) {
+	muxer := oggopus.NewMuxer(file)
+
+	stream, err := muxer.AddStream(
+		oggopus.Head{
+			Channels:        channelsCount,
+			PreSkip:         preSkip,
+			InputSampleRate: sampleRate,
+		},
+		oggopus.Tags{Comments: comments},
+	)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to add opus stream: %w", err)
+	}
+
+	return &oggFile{
+		file:   file,
+		muxer:  muxer,
+		stream: stream,
+	}, nil
+}
+
+func (f *oggFile) writePacket(packet []byte) error {
+	return f.stream.WritePacket(packet)
+}
+
+func (f *oggFile) close() error {
+	if err := f.muxer.Close(); err != nil {
+		_ = f.file.Close()
+		return err
+	}
+
+	return f.file.Close()
+}
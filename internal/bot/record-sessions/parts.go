@@ -0,0 +1,181 @@
+package recordsessions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// limitAction is what session does when the record reaches maximum duration.
+type limitAction string
+
+const (
+	// limitActionStop stops the session with a warning.
+	limitActionStop limitAction = "stop"
+	// limitActionSplit finishes the record as a part and continues recording into the next one.
+	limitActionSplit limitAction = "split"
+)
+
+// partPublishTimeout is how long finished part may take to be uploaded.
+const partPublishTimeout = 10 * time.Minute
+
+func parseLimitAction(value string) (limitAction, error) {
+	switch action := limitAction(value); action {
+	case limitActionStop, limitActionSplit:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown max duration action %q", value)
+	}
+}
+
+func (s *Session) handleDurationLimit() {
+	if s.limitAction == limitActionSplit {
+		err := s.splitRecord()
+		if err == nil {
+			s.limitTimer.Reset(s.maxDuration)
+			return
+		}
+
+		s.logger.Error("failed to split record, stopping session", slog.Any("error", err))
+	}
+
+	s.logger.Debug("record reached maximum duration, stopping session")
+
+	s.limitReached.Store(true)
+
+	if err := s.cycle.Stop(context.TODO()); err != nil {
+		s.logger.Error(
+			"failed to stop session gracefully",
+			slog.Any("error", err),
+		)
+	}
+}
+
+// splitRecord finishes current record as a part and continues recording into the next one.
+// Timeline of the next part begins right where the finished one ends, so there is no gap.
+func (s *Session) splitRecord() error {
+	s.tracksMu.Lock()
+	defer s.tracksMu.Unlock()
+
+	// packets waiting in jitter buffers belong to the finished part
+	if err := s.releasePackets(time.Now()); err != nil {
+		s.logger.Debug("failed to write packet data to file", slog.Any("error", err))
+	}
+
+	finished := s.detachRecord()
+
+	s.part++
+
+	if err := s.startRecord(time.Now(), finished.recordID); err != nil {
+		// the finished part still has to be published
+		s.part--
+		s.restoreRecord(finished)
+
+		return err
+	}
+
+	finished.segments.linkNext(s.recordID)
+
+	s.logger.Info(
+		"record is split into parts",
+		slog.Any("finished_record_id", finished.recordID),
+		slog.Any("record_id", s.recordID),
+		slog.Int("part", s.part),
+	)
+
+	s.parts.Add(1)
+	go func() {
+		defer s.parts.Done()
+
+		finished.publishPart()
+	}()
+
+	return nil
+}
+
+// detachRecord returns session holding current record, so it can be finished independently.
+func (s *Session) detachRecord() *Session {
+	return &Session{
+		logger:        s.logger,
+		recordStorage: s.recordStorage,
+		discordAPI:    s.discordAPI,
+
+		recordID:  s.recordID,
+		recordDir: s.recordDir,
+		startedAt: s.startedAt,
+		endedAt:   time.Now(),
+		streaming: s.streaming,
+		roster:    s.roster,
+
+		tracks:   s.tracks,
+		mixer:    s.mixer,
+		segments: s.segments,
+
+		guildID:         s.guildID,
+		channelID:       s.channelID,
+		guildName:       s.guildName,
+		channelName:     s.channelName,
+		title:           s.title,
+		formats:         s.formats,
+		segmentDuration: s.segmentDuration,
+		multitrack:      s.multitrack,
+		maxDuration:     s.maxDuration,
+		trimSilence:     s.trimSilence,
+		loudnessTarget:  s.loudnessTarget,
+		truePeakLimit:   s.truePeakLimit,
+		noiseGate:       s.noiseGate,
+		autoGainTarget:  s.autoGainTarget,
+		transcriber:     s.transcriber,
+		transcriptions:  s.transcriptions,
+		part:            s.part,
+	}
+}
+
+// restoreRecord makes detached record current again.
+func (s *Session) restoreRecord(detached *Session) {
+	s.recordID = detached.recordID
+	s.recordDir = detached.recordDir
+	s.startedAt = detached.startedAt
+	s.tracks = detached.tracks
+	s.mixer = detached.mixer
+	s.segments = detached.segments
+}
+
+// publishPart finishes and publishes the record detached from the session.
+func (s *Session) publishPart() {
+	ctx, cancel := context.WithTimeout(context.Background(), partPublishTimeout)
+	defer cancel()
+
+	if err := s.closeRecordFiles(); err != nil {
+		s.logger.Error("failed to close record part files", slog.Any("error", err))
+	}
+
+	published, err := s.publishRecord(ctx)
+	if err != nil {
+		// files of the part are kept, so it is recovered on the next start
+		s.logger.Error("failed to publish record part, it is kept until the next start", slog.Any("error", err))
+		return
+	}
+
+	if published {
+		s.sendRecordMessage(ctx, fmt.Sprintf(
+			"Recording has reached %s, part %d is saved and the next part is being recorded.",
+			s.maxDuration, s.part,
+		))
+	}
+
+	s.releaseRecord(published)
+}
+
+// stopIntro returns intro of the message sent when the session stops.
+func (s *Session) stopIntro() string {
+	switch {
+	case s.limitReached.Load():
+		return fmt.Sprintf("Recording has reached the maximum duration of %s and has been stopped.", s.maxDuration)
+	case s.part > 1:
+		return fmt.Sprintf("Got it! This is the last part (%d) of the recording.", s.part)
+	default:
+		return "Got it!"
+	}
+}
@@ -0,0 +1,337 @@
+package recordsessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
+	"github.com/kvizyx/voicelog/internal/audio"
+	"github.com/kvizyx/voicelog/pkg/flac"
+	"github.com/kvizyx/voicelog/pkg/matroska"
+	oggopus "github.com/kvizyx/voicelog/pkg/ogg-opus"
+	"github.com/kvizyx/voicelog/pkg/wav"
+)
+
+const stateName = "session.json"
+
+// sessionState is what is needed to finish the record if the session is interrupted. It is
+// saved into the record directory when the session starts.
+type sessionState struct {
+	RecordID        uuid.UUID        `json:"record_id"`
+	GuildID         snowflake.ID     `json:"guild_id"`
+	ChannelID       snowflake.ID     `json:"channel_id"`
+	GuildName       string           `json:"guild_name"`
+	ChannelName     string           `json:"channel_name"`
+	Title           string           `json:"title,omitempty"`
+	StartedAt       time.Time        `json:"started_at"`
+	Formats         []audio.Format   `json:"formats"`
+	Multitrack      matroska.DocType `json:"multitrack"`
+	SegmentDuration time.Duration    `json:"segment_duration"`
+}
+
+func (s *Session) saveState() error {
+	data, err := json.Marshal(sessionState{
+		RecordID:        s.recordID,
+		GuildID:         s.guildID,
+		ChannelID:       s.channelID,
+		GuildName:       s.guildName,
+		ChannelName:     s.channelName,
+		Title:           s.title,
+		StartedAt:       s.startedAt,
+		Formats:         s.formats,
+		Multitrack:      s.multitrack,
+		SegmentDuration: s.segmentDuration,
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(s.recordDir, stateName), data, 0o644)
+}
+
+// Recover finishes records of the sessions which have been interrupted by the crash of
+// the process. Their files are repaired where possible and uploaded, and if notify is set
+// the download links are sent to the channel the record was made in. It must be called
+// before any session is spawned.
+func (sm *SessionsManager) Recover(ctx context.Context, notify bool) {
+	entries, err := os.ReadDir(recordsDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			sm.Logger.Error("failed to read records directory", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		recordDir := filepath.Join(recordsDir, entry.Name())
+
+		if err = sm.recoverRecord(ctx, recordDir, notify); err != nil {
+			sm.Logger.Error(
+				"failed to recover voice record, it is kept until the next start",
+				slog.String("record_dir", recordDir),
+				slog.Any("error", err),
+			)
+
+			continue
+		}
+
+		_ = os.RemoveAll(recordDir)
+	}
+}
+
+func (sm *SessionsManager) recoverRecord(ctx context.Context, recordDir string, notify bool) error {
+	data, err := os.ReadFile(filepath.Join(recordDir, stateName))
+	if errors.Is(err, fs.ErrNotExist) {
+		// session has not been started, so nothing was recorded
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read session state: %w", err)
+	}
+
+	var state sessionState
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse session state: %w", err)
+	}
+
+	// channel may still be occupied, so recording is picked up again once the gateway is ready
+	sm.mu.Lock()
+	sm.interrupted[state.ChannelID] = struct{}{}
+	sm.mu.Unlock()
+
+	session := &Session{
+		logger: sm.Logger.With(
+			slog.Any("guild_id", state.GuildID),
+			slog.Any("channel_id", state.ChannelID),
+		),
+		recordStorage: sm.S3Storage,
+		discordAPI:    sm.DiscordAPI,
+
+		recordID:  state.RecordID,
+		recordDir: recordDir,
+		startedAt: state.StartedAt,
+
+		guildID:         state.GuildID,
+		channelID:       state.ChannelID,
+		guildName:       state.GuildName,
+		channelName:     state.ChannelName,
+		title:           state.Title,
+		formats:         state.Formats,
+		segmentDuration: state.SegmentDuration,
+		multitrack:      state.Multitrack,
+	}
+
+	session.tracks, err = session.recoverTracks()
+	if err != nil {
+		return err
+	}
+
+	segments, err := session.recoverSegments()
+	if err != nil {
+		return err
+	}
+
+	session.segments = newSegmentUploader(
+		session.logger, session.recordStorage,
+		session.recordID, session.recordDir, session.formats,
+		session.startedAt, session.segmentDuration,
+	)
+	session.segments.recovered = true
+
+	if err = session.segments.loadManifest(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	session.segments.start()
+
+	for _, segment := range segments {
+		session.segments.enqueue(segment)
+	}
+
+	session.logger.Info(
+		"recovering interrupted voice record",
+		slog.Any("record_id", session.recordID),
+		slog.Int("tracks", len(session.tracks)),
+		slog.Int("segments", len(segments)),
+	)
+
+	published, err := session.publishRecord(ctx)
+	if err != nil {
+		return err
+	}
+
+	if published && notify {
+		session.sendRecordMessage(ctx, "Recording has been interrupted, but I've saved what I could.")
+	}
+
+	return nil
+}
+
+// recoverTracks repairs participant tracks which have not been closed.
+func (s *Session) recoverTracks() (map[snowflake.ID]*track, error) {
+	entries, err := os.ReadDir(filepath.Join(s.recordDir, "tracks"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read tracks directory: %w", err)
+	}
+
+	tracks := make(map[snowflake.ID]*track, len(entries))
+
+	for _, entry := range entries {
+		userID, err := snowflake.Parse(strings.TrimSuffix(entry.Name(), ".ogg"))
+		if err != nil || filepath.Ext(entry.Name()) != ".ogg" {
+			continue
+		}
+
+		name := "tracks/" + entry.Name()
+		head, granule, err := repairOggFile(recordFilePath(s.recordDir, name))
+		if err != nil {
+			s.logger.Warn("participant track can not be recovered", slog.Any("user_id", userID), slog.Any("error", err))
+			continue
+		}
+
+		tracks[userID] = &track{
+			userID:       userID,
+			name:         name,
+			nextPosition: int64(granule) - int64(head.PreSkip),
+		}
+	}
+
+	return tracks, nil
+}
+
+// recoverSegments repairs mix segments which have not been uploaded.
+func (s *Session) recoverSegments() ([]*mixSegment, error) {
+	entries, err := os.ReadDir(filepath.Join(s.recordDir, "segments"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read segments directory: %w", err)
+	}
+
+	segmentFrames := max(1, durationSamples(s.segmentDuration)/frameSamples)
+	segments := make(map[int]*mixSegment)
+	indexes := make([]int, 0)
+
+	for _, entry := range entries {
+		format, found := audio.FormatOf(entry.Name())
+		if !found {
+			continue
+		}
+
+		index, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSuffix(entry.Name(), format.Extension()), "mix-"))
+		if err != nil {
+			continue
+		}
+
+		name := "segments/" + entry.Name()
+		frames, err := repairSegmentFile(recordFilePath(s.recordDir, name), format)
+		if err != nil {
+			s.logger.Warn("mix segment can not be recovered", slog.String("file", name), slog.Any("error", err))
+			continue
+		}
+
+		segment, found := segments[index]
+		if !found {
+			segment = &mixSegment{index: index, startFrame: int64(index) * segmentFrames}
+			segments[index] = segment
+			indexes = append(indexes, index)
+		}
+
+		segment.frames = max(segment.frames, frames)
+		segment.outputs = append(segment.outputs, &encodedFile{name: name, format: format})
+	}
+
+	recovered := make([]*mixSegment, 0, len(segments))
+	for _, index := range indexes {
+		recovered = append(recovered, segments[index])
+	}
+
+	return recovered, nil
+}
+
+// repairSegmentFile repairs mix segment file and returns number of frames in it.
+func repairSegmentFile(path string, format audio.Format) (int64, error) {
+	switch format {
+	case audio.FormatOpus:
+		head, granule, err := repairOggFile(path)
+		if err != nil {
+			return 0, err
+		}
+
+		return (int64(granule) - int64(head.PreSkip)) / frameSamples, nil
+
+	case audio.FormatWAV:
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close() // nolint: errcheck
+
+		samples, err := wav.Repair(file)
+		if err != nil {
+			return 0, err
+		}
+
+		return samples / frameSamples, file.Close()
+
+	case audio.FormatFLAC:
+		// FLAC stream info is written with unknown length until the file is closed, which is
+		// valid, and decoders stop at the truncated frame themselves, so only its frames are counted
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close() // nolint: errcheck
+
+		samples, err := flac.CountSamples(file)
+		if err != nil {
+			return 0, err
+		}
+
+		return int64(samples) / frameSamples, nil
+
+	default:
+		return 0, nil
+	}
+}
+
+// repairOggFile rewrites damaged Ogg Opus file in place.
+func repairOggFile(path string) (oggopus.Head, uint64, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return oggopus.Head{}, 0, err
+	}
+	defer in.Close() // nolint: errcheck
+
+	out, err := os.Create(path + ".repaired")
+	if err != nil {
+		return oggopus.Head{}, 0, err
+	}
+	defer out.Close() // nolint: errcheck
+
+	head, granule, err := oggopus.Repair(out, in)
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return oggopus.Head{}, 0, err
+	}
+
+	if err = out.Close(); err != nil {
+		return oggopus.Head{}, 0, err
+	}
+
+	return head, granule, os.Rename(out.Name(), path)
+}
@@ -0,0 +1,234 @@
+package recordsessions
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
+)
+
+const metadataName = "metadata.json"
+
+// roster keeps track of the members presence in the voice channel of the session.
+type roster struct {
+	members map[snowflake.ID]*rosterMember
+	mu      sync.Mutex
+}
+
+type rosterMember struct {
+	name     string
+	presence []timeInterval // end of the last interval is zero while the member is in the channel
+}
+
+type timeInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func newRoster() *roster {
+	return &roster{members: make(map[snowflake.ID]*rosterMember)}
+}
+
+func (r *roster) join(userID snowflake.ID, name string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	member := r.member(userID, name)
+	member.presence = append(member.presence, timeInterval{Start: at})
+}
+
+func (r *roster) leave(userID snowflake.ID, name string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	member := r.member(userID, name)
+
+	// member might have joined before the session has been started
+	if n := len(member.presence); n == 0 || !member.presence[n-1].End.IsZero() {
+		member.presence = append(member.presence, timeInterval{})
+	}
+
+	member.presence[len(member.presence)-1].End = at
+}
+
+// name returns display name of the member, or empty string if the member is not known.
+func (r *roster) name(userID snowflake.ID) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if member, found := r.members[userID]; found {
+		return member.name
+	}
+
+	return ""
+}
+
+// has reports whether the member has joined or left the channel during the session.
+func (r *roster) has(userID snowflake.ID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, found := r.members[userID]
+
+	return found
+}
+
+func (r *roster) member(userID snowflake.ID, name string) *rosterMember {
+	member, found := r.members[userID]
+	if !found {
+		member = &rosterMember{}
+		r.members[userID] = member
+	}
+
+	if name != "" {
+		member.name = name
+	}
+
+	return member
+}
+
+// presence returns names and presence of the members who have been in the channel between
+// given moments, with presence intervals clipped to them.
+func (r *roster) presence(start, end time.Time) map[snowflake.ID]participantMetadata {
+	participants := make(map[snowflake.ID]participantMetadata)
+
+	// roster of the recovered record is not known
+	if r == nil {
+		return participants
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for userID, member := range r.members {
+		var presence []timeInterval
+
+		for _, interval := range member.presence {
+			if interval.End.IsZero() || interval.End.After(end) {
+				interval.End = end
+			}
+			if interval.Start.Before(start) {
+				interval.Start = start
+			}
+
+			if interval.End.After(interval.Start) {
+				presence = append(presence, interval)
+			}
+		}
+
+		if len(presence) != 0 {
+			participants[userID] = participantMetadata{
+				UserID:   userID,
+				Name:     member.name,
+				Presence: presence,
+			}
+		}
+	}
+
+	return participants
+}
+
+// recordMetadata describes where and when the record has been made and who took part in it.
+type recordMetadata struct {
+	RecordID     uuid.UUID             `json:"record_id"`
+	GuildID      snowflake.ID          `json:"guild_id"`
+	ChannelID    snowflake.ID          `json:"channel_id"`
+	Part         int                   `json:"part"`
+	StartedAt    time.Time             `json:"started_at"`
+	EndedAt      time.Time             `json:"ended_at"`
+	Participants []participantMetadata `json:"participants"`
+}
+
+type participantMetadata struct {
+	UserID   snowflake.ID   `json:"user_id"`
+	Name     string         `json:"name"`
+	Track    string         `json:"track,omitempty"` // name of the track file within the record
+	Presence []timeInterval `json:"presence"`        // when the member has been in the channel
+	Speaking []timeInterval `json:"speaking"`
+}
+
+// participants returns everyone who has been in the channel during the record or has a track
+// in it, ordered by user id.
+func (s *Session) participants(ctx context.Context) []participantMetadata {
+	participants := s.roster.presence(s.startedAt, s.endedAt)
+
+	for _, userTrack := range s.tracks {
+		participant, found := participants[userTrack.userID]
+		if !found {
+			participant = participantMetadata{
+				UserID: userTrack.userID,
+				Name:   s.memberName(ctx, userTrack.userID),
+			}
+		}
+
+		participant.Track = userTrack.name
+
+		for _, span := range userTrack.speech.spans {
+			participant.Speaking = append(participant.Speaking, timeInterval{
+				Start: s.startedAt.Add(samplesDuration(span[0])),
+				End:   s.startedAt.Add(samplesDuration(span[1])),
+			})
+		}
+
+		participants[userTrack.userID] = participant
+	}
+
+	sorted := make([]participantMetadata, 0, len(participants))
+
+	for _, participant := range participants {
+		if participant.Presence == nil {
+			participant.Presence = make([]timeInterval, 0)
+		}
+		if participant.Speaking == nil {
+			participant.Speaking = make([]timeInterval, 0)
+		}
+
+		sorted = append(sorted, participant)
+	}
+
+	slices.SortFunc(sorted, func(a, b participantMetadata) int {
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+
+	return sorted
+}
+
+// participantNames returns names of the participants in the same order.
+func participantNames(participants []participantMetadata) []string {
+	names := make([]string, 0, len(participants))
+	for _, participant := range participants {
+		names = append(names, participant.Name)
+	}
+
+	return names
+}
+
+// writeMetadata writes metadata of the record with the roster of participants.
+func (s *Session) writeMetadata(ctx context.Context, participants []participantMetadata) error {
+	// members presence is not known for the recovered record
+	if s.roster == nil {
+		return nil
+	}
+
+	metadata := recordMetadata{
+		RecordID:     s.recordID,
+		GuildID:      s.guildID,
+		ChannelID:    s.channelID,
+		Part:         s.part,
+		StartedAt:    s.startedAt,
+		EndedAt:      s.endedAt,
+		Participants: participants,
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.writeRecordData(ctx, metadataName, data)
+}
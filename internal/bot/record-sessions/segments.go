@@ -0,0 +1,341 @@
+package recordsessions
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizyx/voicelog/internal/audio"
+	"github.com/kvizyx/voicelog/pkg/logger"
+)
+
+const (
+	manifestName = "manifest.json"
+
+	segmentUploadTimeout = 1 * time.Minute
+
+	// maxQueuedSegments is how many finished segments may wait for the upload
+	// before the mixer is blocked.
+	maxQueuedSegments = 16
+)
+
+// manifest describes segments of the record mix. It is uploaded along with every
+// segment, so the record stays usable even if the session is never stopped gracefully.
+type manifest struct {
+	RecordID        uuid.UUID         `json:"record_id"`
+	StartedAt       time.Time         `json:"started_at"`
+	SegmentDuration float64           `json:"segment_duration"`    // in seconds
+	Complete        bool              `json:"complete"`            // whether the session has been stopped
+	Recovered       bool              `json:"recovered,omitempty"` // whether the session has been interrupted
+	Part            int               `json:"part"`                // number of the record among parts of the session
+	PreviousPart    *uuid.UUID        `json:"previous_part,omitempty"`
+	NextPart        *uuid.UUID        `json:"next_part,omitempty"`
+	Playlists       map[string]string `json:"playlists"` // names of playlist files by mix format
+	Segments        []manifestSegment `json:"segments"`
+}
+
+type manifestSegment struct {
+	Index    int               `json:"index"`
+	Start    float64           `json:"start"`    // offset from the beginning of the record (in seconds)
+	Duration float64           `json:"duration"` // in seconds
+	Files    map[string]string `json:"files"`    // names of segment files by mix format
+}
+
+// segmentUploader uploads finished segments of the mix while the recording continues
+// and keeps the manifest and playlists of the record up to date.
+type segmentUploader struct {
+	logger        logger.Logger
+	recordStorage RecordStorage
+
+	recordID  uuid.UUID
+	recordDir string
+	formats   []audio.Format
+
+	queue chan *mixSegment
+	done  chan struct{}
+
+	manifest  manifest
+	streaming bool          // whether segment files are uploaded while they are written
+	recovered bool          // whether segments are recovered after the crash
+	failed    []*mixSegment // segments which upload has failed, retried on finish
+	mu        sync.Mutex
+}
+
+func newSegmentUploader(
+	logger logger.Logger,
+	recordStorage RecordStorage,
+	recordID uuid.UUID,
+	recordDir string,
+	formats []audio.Format,
+	startedAt time.Time,
+	segmentDuration time.Duration,
+) *segmentUploader {
+	playlists := make(map[string]string, len(formats))
+	for _, format := range formats {
+		playlists[string(format)] = playlistName(format)
+	}
+
+	return &segmentUploader{
+		logger:        logger,
+		recordStorage: recordStorage,
+		recordID:      recordID,
+		recordDir:     recordDir,
+		formats:       formats,
+		queue:         make(chan *mixSegment, maxQueuedSegments),
+		done:          make(chan struct{}),
+		manifest: manifest{
+			RecordID:        recordID,
+			StartedAt:       startedAt,
+			SegmentDuration: segmentDuration.Seconds(),
+			Playlists:       playlists,
+			Segments:        make([]manifestSegment, 0),
+		},
+	}
+}
+
+// start starts uploading segments in background.
+func (u *segmentUploader) start() {
+	go func() {
+		defer close(u.done)
+
+		for segment := range u.queue {
+			ctx, cancel := context.WithTimeout(context.Background(), segmentUploadTimeout)
+			err := u.upload(ctx, segment)
+			cancel()
+
+			if err != nil && u.streaming {
+				// streamed data is gone along with the failed upload
+				u.logger.Error(
+					"failed to upload mix segment, it is lost",
+					slog.Int("segment", segment.index),
+					slog.Any("error", err),
+				)
+
+				continue
+			}
+
+			if err != nil {
+				u.logger.Error(
+					"failed to upload mix segment, retrying when session stops",
+					slog.Int("segment", segment.index),
+					slog.Any("error", err),
+				)
+
+				u.mu.Lock()
+				u.failed = append(u.failed, segment)
+				u.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// link sets position of the record among parts of the session. Previous part of the first one is uuid.Nil.
+func (u *segmentUploader) link(part int, previousPart uuid.UUID) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.manifest.Part = part
+	if previousPart != uuid.Nil {
+		u.manifest.PreviousPart = &previousPart
+	}
+}
+
+// linkNext sets record which continues this one.
+func (u *segmentUploader) linkNext(nextPart uuid.UUID) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.manifest.NextPart = &nextPart
+}
+
+// enqueue schedules upload of the finished segment.
+func (u *segmentUploader) enqueue(segment *mixSegment) {
+	u.queue <- segment
+}
+
+// finish waits for queued segments, retries failed uploads and marks the manifest as complete.
+func (u *segmentUploader) finish(ctx context.Context) error {
+	close(u.queue)
+	<-u.done
+
+	u.mu.Lock()
+	failed := u.failed
+	u.failed = nil
+	u.mu.Unlock()
+
+	for _, segment := range failed {
+		if err := u.upload(ctx, segment); err != nil {
+			return err
+		}
+	}
+
+	if len(u.manifest.Segments) == 0 {
+		return nil
+	}
+
+	u.mu.Lock()
+	u.manifest.Complete = true
+	u.manifest.Recovered = u.recovered
+	u.mu.Unlock()
+
+	return u.uploadIndex(ctx)
+}
+
+// segments returns number of uploaded segments.
+func (u *segmentUploader) segments() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return len(u.manifest.Segments)
+}
+
+// uploaded returns segments which are in the storage, in order of their indexes.
+func (u *segmentUploader) uploaded() []manifestSegment {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return slices.Clone(u.manifest.Segments)
+}
+
+// upload uploads segment files, then updated manifest and playlists.
+func (u *segmentUploader) upload(ctx context.Context, segment *mixSegment) error {
+	files := make(map[string]string, len(segment.outputs))
+
+	for _, output := range segment.outputs {
+		if err := output.close(); err != nil {
+			return fmt.Errorf("failed to close mix segment: %w", err)
+		}
+
+		if !u.streaming {
+			path := recordFilePath(u.recordDir, output.name)
+
+			if err := u.recordStorage.UploadRecordFile(ctx, u.recordID, recordTTL, output.name, path); err != nil {
+				return fmt.Errorf("failed to upload mix segment: %w", err)
+			}
+		}
+
+		files[string(output.format)] = output.name
+	}
+
+	u.mu.Lock()
+	// segment is already in the manifest if its upload has been retried after the crash
+	u.manifest.Segments = slices.DeleteFunc(u.manifest.Segments, func(uploaded manifestSegment) bool {
+		return uploaded.Index == segment.index
+	})
+	u.manifest.Segments = append(u.manifest.Segments, manifestSegment{
+		Index:    segment.index,
+		Start:    float64(segment.startFrame*frameSamples) / sampleRate,
+		Duration: float64(segment.frames*frameSamples) / sampleRate,
+		Files:    files,
+	})
+	// segments which upload has been retried come out of order
+	slices.SortFunc(u.manifest.Segments, func(a, b manifestSegment) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+	u.mu.Unlock()
+
+	if err := u.uploadIndex(ctx); err != nil {
+		return err
+	}
+
+	// segment is already in the storage, no need to keep it on disk for the rest of the session
+	for _, output := range segment.outputs {
+		_ = os.Remove(recordFilePath(u.recordDir, output.name))
+	}
+
+	u.logger.Debug("mix segment uploaded", slog.Int("segment", segment.index))
+
+	return nil
+}
+
+// loadManifest restores manifest saved by the session which has been interrupted.
+func (u *segmentUploader) loadManifest() error {
+	data, err := os.ReadFile(filepath.Join(u.recordDir, manifestName))
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return json.Unmarshal(data, &u.manifest)
+}
+
+// uploadIndex uploads manifest and playlists describing currently uploaded segments.
+func (u *segmentUploader) uploadIndex(ctx context.Context) error {
+	u.mu.Lock()
+	manifestData, err := json.MarshalIndent(u.manifest, "", "  ")
+	playlists := make(map[string][]byte, len(u.formats))
+	for _, format := range u.formats {
+		playlists[playlistName(format)] = makePlaylist(format, u.manifest.Segments)
+	}
+	u.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err = u.uploadData(ctx, manifestName, manifestData); err != nil {
+		return fmt.Errorf("failed to upload manifest: %w", err)
+	}
+
+	for name, data := range playlists {
+		if err = u.uploadData(ctx, name, data); err != nil {
+			return fmt.Errorf("failed to upload playlist: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// uploadData uploads file of the record with given content. Unless files are streamed, it is
+// kept in the record directory too, as the interrupted session is recovered from there.
+func (u *segmentUploader) uploadData(ctx context.Context, name string, data []byte) error {
+	if u.streaming {
+		out := u.recordStorage.UploadRecordStream(ctx, u.recordID, recordTTL, name)
+
+		if _, err := out.Write(data); err != nil {
+			_ = out.Close()
+			return err
+		}
+
+		return out.Close()
+	}
+
+	path := recordFilePath(u.recordDir, name)
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return u.recordStorage.UploadRecordFile(ctx, u.recordID, recordTTL, name, path)
+}
+
+// playlistName returns name of the playlist of mix segments in given format.
+func playlistName(format audio.Format) string {
+	return "mix" + format.Extension() + ".m3u"
+}
+
+// makePlaylist makes extended M3U playlist of mix segments. Segments are referenced
+// relatively to the playlist, so it can be opened by its download link.
+func makePlaylist(format audio.Format, segments []manifestSegment) []byte {
+	var playlist strings.Builder
+
+	playlist.WriteString("#EXTM3U\n")
+
+	for _, segment := range segments {
+		fmt.Fprintf(&playlist, "#EXTINF:%d,Part %d\n", int(segment.Duration+0.5), segment.Index+1)
+		playlist.WriteString(segment.Files[string(format)] + "\n")
+	}
+
+	return []byte(playlist.String())
+}
@@ -1,10 +1,16 @@
 package recordsessions
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -14,47 +20,130 @@ import (
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/google/uuid"
 	"github.com/kvizyx/cycle"
+	"github.com/kvizyx/voicelog/internal/audio"
+	"github.com/kvizyx/voicelog/internal/transcription"
 	"github.com/kvizyx/voicelog/pkg/logger"
-	"github.com/pion/rtp"
-	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+	"github.com/kvizyx/voicelog/pkg/matroska"
 )
 
 type SessionID = snowflake.ID
 
+var errStreamedFile = errors.New("record file is streamed to the storage and can not be rewritten")
+
 const (
-	sessionTTL = 1 * time.Hour
-	recordTTL  = 7 * 24 * time.Hour // 1 week
+	// recordsDir is where files of the records are kept until they are uploaded.
+	recordsDir = ".tmp"
+
+	recordTTL = 7 * 24 * time.Hour // 1 week
+
+	memberLookupTimeout = 2 * time.Second
+	// memberLookupRetry is how long audio of the user waits before the failed lookup is retried.
+	memberLookupRetry = 5 * time.Second
 )
 
-type VoiceUploader interface {
-	UploadVoice(
+type RecordStorage interface {
+	UploadRecordFile(
+		ctx context.Context,
+		recordID uuid.UUID,
+		ttl time.Duration,
+		name, filePath string,
+	) error
+	UploadRecordStream(
 		ctx context.Context,
+		recordID uuid.UUID,
 		ttl time.Duration,
-		filePath string,
-	) (uuid.UUID, error)
+		name string,
+	) io.WriteCloser
+	DownloadRecordFile(ctx context.Context, recordID uuid.UUID, name string) (io.ReadCloser, error)
 }
 
+// createFileFunc creates file of the record with given name.
+type createFileFunc func(name string) (io.WriteCloser, error)
+
 type Session struct {
 	logger        logger.Logger
-	voiceUploader VoiceUploader
+	recordStorage RecordStorage
 
 	voiceManager voice.Manager
 	discordAPI   rest.Rest
+	member       func(guildID, userID snowflake.ID) (discord.Member, bool) // cached guild member
+
+	voiceConn voice.Conn
+
+	firstRecordID uuid.UUID // id of the first part, reserved when the session is spawned
+
+	recordID  uuid.UUID
+	recordDir string
+	startedAt time.Time // beginning of the session timeline
+	endedAt   time.Time // when recording into the record has been finished
+	streaming bool      // whether files are uploaded while they are written
 
-	voiceConn    voice.Conn
-	recordWriter *oggwriter.OggWriter
+	tracks         map[snowflake.ID]*track // participant tracks by user id
+	mixer          *mixer
+	segments       *segmentUploader
+	ssrcUsers      map[uint32]snowflake.ID
+	pendingPackets map[uint32][]receivedPacket // packets of SSRCs not yet mapped to users
+	jitterBuffers  map[uint32]*jitterBuffer
+	ignoredSSRCs   map[uint32]struct{}        // SSRCs of bots, which are not recorded
+	bots           map[snowflake.ID]bool      // whether the user is a bot, for resolved users
+	memberLookups  map[snowflake.ID]time.Time // when the user has been looked up, for unresolved users
+	tracksMu       sync.Mutex
 
 	channelNotEmpty atomic.Bool   // does anyone ever joined current voice room
 	channelMembers  atomic.Uint32 // current number of voice room members
+	roster          *roster       // presence of members in the voice room, shared by all parts
+
+	guildID     snowflake.ID
+	channelID   snowflake.ID
+	guildName   string // for the record tags
+	channelName string
+	title       string         // title of the record, made of the guild and channel names if empty
+	formats     []audio.Format // formats of the mix
+
+	segmentDuration time.Duration // duration of the mix segments
+
+	multitrack     matroska.DocType // container of the multitrack file, not written if empty
+	multitrackName string           // name of the multitrack file within the record
+	hasSpeakers    bool             // whether the speaker timeline is written
+	waveformImage  []byte           // preview of the mix waveform (PNG), attached to the record message
+
+	trimSilence time.Duration // longest silence kept in the trimmed mix, it is not written if zero
+
+	loudnessTarget float64 // loudness of the normalized tracks (in LUFS), tracks are not normalized if zero
+	truePeakLimit  float64 // in dBTP
+
+	noiseGate      float64 // threshold of the noise gate applied to speakers in the mix (in dBFS), disabled if zero
+	autoGainTarget float64 // level speakers are brought to in the mix (in dBFS), disabled if zero
+
+	transcriber    transcription.Transcriber // transcribes finished records, disabled if nil
+	transcriptions *transcriptionQueue       // where published records are queued for transcription, nil if disabled
+
+	maxDuration  time.Duration // not limited if zero
+	limitAction  limitAction
+	limitTimer   *time.Timer // nil if duration is not limited
+	limitReached atomic.Bool // whether the session is stopped by the duration limit
 
-	guildID   snowflake.ID
-	channelID snowflake.ID
+	paused   atomic.Bool // whether received audio is dropped
+	stopping atomic.Bool // whether the session has been asked to stop
+
+	status   Status // reported to the members, record fields are updated when it starts
+	statusMu sync.Mutex
+
+	part  int            // number of the record among parts of the session, starting from 1
+	parts sync.WaitGroup // publications of finished parts
 
 	cycle cycle.Cycle
 }
 
+// receivedPacket is a voice packet with the moment it has arrived at.
+type receivedPacket struct {
+	*voice.Packet
+	arrivedAt time.Time
+	lost      int // number of packets lost right before this one
+}
+
 func (s *Session) Start() error {
-	sessionCtx, cancel := context.WithTimeout(context.Background(), sessionTTL)
+	sessionCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	s.cycle = cycle.New(
@@ -83,15 +172,240 @@ func (s *Session) worker() {
 		return
 	}
 
-	rtpPacket := s.makeRTPPacket(opusPacket)
-
-	if err = s.recordWriter.WriteRTP(rtpPacket); err != nil {
+	if err = s.handlePacket(receivedPacket{Packet: opusPacket, arrivedAt: time.Now()}); err != nil {
 		s.logger.Debug("failed to write packet data to file", slog.Any("error", err))
 		return
 	}
 }
 
+// handlePacket passes packet through the jitter buffer of its SSRC, then packets released
+// in order are routed to the tracks and into the mix.
+func (s *Session) handlePacket(packet receivedPacket) error {
+	s.tracksMu.Lock()
+	defer s.tracksMu.Unlock()
+
+	// the record is finished, its tracks may be transcribed in background
+	if s.paused.Load() || !s.endedAt.IsZero() {
+		return nil
+	}
+
+	if _, ignored := s.ignoredSSRCs[packet.SSRC]; ignored || packet.SSRC == s.voiceConn.Gateway().SSRC() {
+		return nil
+	}
+
+	buffer, found := s.jitterBuffers[packet.SSRC]
+	if !found {
+		buffer = &jitterBuffer{}
+		s.jitterBuffers[packet.SSRC] = buffer
+	}
+
+	for _, flushed := range buffer.push(packet) {
+		if err := s.routePacket(flushed); err != nil {
+			return err
+		}
+	}
+
+	if err := s.releasePackets(packet.arrivedAt.Add(-jitterDelay)); err != nil {
+		return err
+	}
+
+	return s.mixer.flush(s.timelinePosition(packet.arrivedAt) - durationSamples(mixLatency))
+}
+
+// releasePackets routes packets of all jitter buffers which have been waited for until the
+// deadline, and moves buffers statistics to the tracks.
+func (s *Session) releasePackets(deadline time.Time) error {
+	for ssrc, buffer := range s.jitterBuffers {
+		for _, packet := range buffer.release(deadline) {
+			if err := s.routePacket(packet); err != nil {
+				return err
+			}
+		}
+
+		if userTrack, found := s.tracks[s.ssrcUsers[ssrc]]; found {
+			userTrack.stats.add(buffer.takeStats())
+		}
+	}
+
+	return nil
+}
+
+// routePacket routes packet to the track of the user it belongs to and into the mix.
+func (s *Session) routePacket(packet receivedPacket) error {
+	userID, found := s.userBySSRC(packet.SSRC)
+	if !found {
+		if pending := s.pendingPackets[packet.SSRC]; len(pending) < maxPendingPackets {
+			s.pendingPackets[packet.SSRC] = append(pending, packet)
+		}
+
+		return nil
+	}
+
+	if _, ignored := s.ignoredSSRCs[packet.SSRC]; ignored {
+		delete(s.pendingPackets, packet.SSRC)
+		return nil
+	}
+
+	userTrack, err := s.userTrack(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, pendingPacket := range s.pendingPackets[packet.SSRC] {
+		if err = s.recordPacket(userTrack, pendingPacket); err != nil {
+			return err
+		}
+	}
+	delete(s.pendingPackets, packet.SSRC)
+
+	return s.recordPacket(userTrack, packet)
+}
+
+// recordPacket writes packet to the participant track and mixes its decoded audio.
+func (s *Session) recordPacket(userTrack *track, packet receivedPacket) error {
+	position := userTrack.clock.position(packet.Packet, s.timelinePosition(packet.arrivedAt))
+
+	// speaker stops talking with a few silence frames, and gaps in the track are filled
+	// with silence anyway
+	if bytes.Equal(packet.Opus, silenceFrame) {
+		return nil
+	}
+
+	if err := s.concealLoss(userTrack, packet, position); err != nil {
+		// packet itself can still be recorded, lost audio is left as silence
+		s.logger.Debug("failed to conceal lost packets", slog.Any("error", err))
+	}
+
+	pcm, err := userTrack.decode(packet.Packet)
+	if err != nil {
+		return err
+	}
+
+	if err = userTrack.writePacket(packet.Opus, position, len(pcm)/channelsCount); err != nil {
+		return err
+	}
+
+	if isSpeech(pcm) {
+		samples := int64(len(pcm) / channelsCount)
+
+		userTrack.speech.add(position, position+samples)
+		s.mixer.markSpeech(position, samples)
+	}
+
+	userTrack.dynamics.process(pcm)
+
+	s.mixer.add(position, pcm)
+
+	return nil
+}
+
+// timelinePosition returns position of the moment on the session timeline (in samples).
+func (s *Session) timelinePosition(moment time.Time) int64 {
+	return int64(moment.Sub(s.startedAt).Seconds() * sampleRate)
+}
+
+// userBySSRC returns id of the user which sends audio with given SSRC. Mapping comes
+// from speaking updates of the voice gateway, and the user has to be known as a human or
+// a bot, so it might be unknown for a few first packets.
+func (s *Session) userBySSRC(ssrc uint32) (snowflake.ID, bool) {
+	userID, found := s.ssrcUsers[ssrc]
+	if !found {
+		if userID = s.voiceConn.UserIDBySSRC(ssrc); userID == 0 {
+			return 0, false
+		}
+
+		s.ssrcUsers[ssrc] = userID
+	}
+
+	bot, resolved := s.isBot(userID)
+	if !resolved {
+		return 0, false
+	}
+
+	if bot {
+		s.ignoredSSRCs[ssrc] = struct{}{}
+		s.logger.Debug("ignoring audio of the bot", slog.Any("user_id", userID))
+	}
+
+	return userID, true
+}
+
+// isBot reports whether the user is a bot, and whether it is known yet. Members who have
+// joined the channel are humans, others are taken from the members cache. Members missing
+// there are fetched in background, and the lookup is retried later if it fails.
+func (s *Session) isBot(userID snowflake.ID) (bool, bool) {
+	if bot, found := s.bots[userID]; found {
+		return bot, true
+	}
+
+	// join events are not sent for bots
+	if s.roster.has(userID) {
+		s.bots[userID] = false
+		return false, true
+	}
+
+	if member, found := s.member(s.guildID, userID); found {
+		s.bots[userID] = member.User.Bot
+		return member.User.Bot, true
+	}
+
+	if lookedUp, found := s.memberLookups[userID]; !found || time.Since(lookedUp) > memberLookupRetry {
+		s.memberLookups[userID] = time.Now()
+
+		go s.lookupMember(userID)
+	}
+
+	return false, false
+}
+
+// lookupMember fetches the guild member to know whether it is a bot.
+func (s *Session) lookupMember(userID snowflake.ID) {
+	ctx, cancel := context.WithTimeout(context.Background(), memberLookupTimeout)
+	defer cancel()
+
+	member, err := s.discordAPI.GetMember(s.guildID, userID, rest.WithCtx(ctx))
+	if err != nil {
+		s.logger.Debug("failed to get guild member", slog.Any("user_id", userID), slog.Any("error", err))
+		return
+	}
+
+	s.tracksMu.Lock()
+	defer s.tracksMu.Unlock()
+
+	s.bots[userID] = member.User.Bot
+	delete(s.memberLookups, userID)
+}
+
+// userTrack returns track of the user, creating it on the first call.
+func (s *Session) userTrack(userID snowflake.ID) (*track, error) {
+	if userTrack, found := s.tracks[userID]; found {
+		return userTrack, nil
+	}
+
+	comments := s.recordTags().trackComments(userID, s.roster.name(userID))
+
+	userTrack, err := newTrack(s.createRecordFile, userID, comments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create track: %w", err)
+	}
+
+	userTrack.dynamics = newSpeakerDynamics(s.noiseGate, s.autoGainTarget)
+
+	s.tracks[userID] = userTrack
+
+	s.logger.Debug("participant track created", slog.Any("user_id", userID))
+
+	return userTrack, nil
+}
+
 func (s *Session) onStart(ctx context.Context) error {
+	s.ssrcUsers = make(map[uint32]snowflake.ID)
+	s.pendingPackets = make(map[uint32][]receivedPacket)
+	s.jitterBuffers = make(map[uint32]*jitterBuffer)
+	s.ignoredSSRCs = make(map[uint32]struct{})
+	s.bots = make(map[snowflake.ID]bool)
+	s.memberLookups = make(map[snowflake.ID]time.Time)
+
 	s.voiceConn = s.voiceManager.CreateConn(s.guildID)
 
 	if err := s.voiceConn.Open(ctx, s.channelID, true, false); err != nil {
@@ -102,60 +416,414 @@ func (s *Session) onStart(ctx context.Context) error {
 		return fmt.Errorf("failed to send speaking packet: %w", err)
 	}
 
-	recordPath := fmt.Sprintf(".tmp/channel%d.ogg", s.channelID)
+	s.fetchNames(ctx)
 
-	recordWriter, err := oggwriter.New(recordPath, 48000, 2)
-	if err != nil {
-		return fmt.Errorf("failed to create OGG writer: %w", err)
+	s.part = 1
+
+	if err := s.startRecord(time.Now(), uuid.Nil); err != nil {
+		return err
 	}
 
-	s.recordWriter = recordWriter
+	// duration of the record is not limited if zero
+	if s.maxDuration != 0 {
+		s.limitTimer = time.AfterFunc(s.maxDuration, func() {
+			s.cycle.SendEvent(EventDurationLimit{})
+		})
+	}
 
-	s.logger.Info("voice recording session started")
+	s.logger.Info("voice recording session started", slog.Any("record_id", s.recordID))
+
+	return nil
+}
+
+// startRecord starts new record of the session, which timeline begins at given moment.
+func (s *Session) startRecord(startedAt time.Time, previousPart uuid.UUID) error {
+	// the first part takes the id reserved when the session has been spawned
+	recordID := s.firstRecordID
+
+	var err error
+	if previousPart != uuid.Nil {
+		if recordID, err = uuid.NewRandom(); err != nil {
+			return fmt.Errorf("failed to generate id for voice record: %w", err)
+		}
+	}
+
+	s.recordID = recordID
+	s.recordDir = filepath.Join(recordsDir, recordID.String())
+	s.startedAt = startedAt
+
+	// streamed record is not kept locally, so it can not be recovered after the crash
+	if !s.streaming {
+		for _, dir := range []string{"tracks", "segments"} {
+			if err = os.MkdirAll(filepath.Join(s.recordDir, dir), 0o755); err != nil {
+				return fmt.Errorf("failed to create record directory: %w", err)
+			}
+		}
+
+		if err = s.saveState(); err != nil {
+			return fmt.Errorf("failed to save session state: %w", err)
+		}
+	}
+
+	s.tracks = make(map[snowflake.ID]*track)
+	s.multitrackName = ""
+
+	s.segments = newSegmentUploader(
+		s.logger, s.recordStorage,
+		s.recordID, s.recordDir, s.formats,
+		s.startedAt, s.segmentDuration,
+	)
+	s.segments.streaming = s.streaming
+	s.segments.link(s.part, previousPart)
+	s.segments.start()
+
+	s.mixer = newMixer(
+		s.createRecordFile,
+		s.formats,
+		s.segmentDuration,
+		s.trimSilence,
+		s.mixComments(),
+		s.segments.enqueue,
+	)
+
+	s.setRecordStatus(s.recordID, s.part)
 
 	return nil
 }
 
 func (s *Session) onStop(ctx context.Context) error {
-	recordPath := fmt.Sprintf(".tmp/channel%d.ogg", s.channelID)
+	// parts finished before are published independently, session ends when all of them are done
+	defer s.parts.Wait()
 
 	defer func() {
 		s.voiceManager.Close(ctx)
 		s.voiceManager.RemoveConn(s.guildID)
-
-		_ = os.Remove(recordPath)
 	}()
 
-	recordID, err := s.voiceUploader.UploadVoice(ctx, recordTTL, recordPath)
+	s.stopping.Store(true)
+
+	if s.limitTimer != nil {
+		s.limitTimer.Stop()
+	}
+
+	s.tracksMu.Lock()
+	defer s.tracksMu.Unlock()
+
+	s.endedAt = time.Now()
+
+	if err := s.releasePackets(s.endedAt); err != nil {
+		s.logger.Debug("failed to write packet data to file", slog.Any("error", err))
+	}
+
+	closeErr := s.closeRecordFiles()
+
+	// files of the record which failed to be published are kept, so it is recovered on the next start
+	published, err := s.publishRecord(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to upload voice record: %w", err)
+		return err
 	}
 
-	s.logger.Info("voice record uploaded", slog.Any("record_id", recordID))
+	if published {
+		s.sendRecordMessage(ctx, s.stopIntro())
+	}
 
-	_, _ = s.discordAPI.CreateMessage(
-		s.channelID,
-		discord.MessageCreate{
-			Content: fmt.Sprintf(`Got it! Download link - http://localhost:8080/api/voices/%s`, recordID.String()),
-		},
-		rest.WithCtx(ctx),
+	s.releaseRecord(published)
+
+	return closeErr
+}
+
+// releaseRecord removes files of the finished record, unless the published record is queued
+// for transcription, which removes them when it is done.
+func (s *Session) releaseRecord(published bool) {
+	if published && s.transcriptions != nil && len(s.tracks) != 0 {
+		// record is not published once again by the recovery, if the process stops before
+		// the transcription is done
+		_ = os.Remove(filepath.Join(s.recordDir, stateName))
+
+		if s.transcriptions.add(s) {
+			return
+		}
+	}
+
+	_ = os.RemoveAll(s.recordDir)
+}
+
+// publishRecord uploads all files of the record which are not in the storage yet. It reports
+// whether the record has been published, as the record is discarded if nobody spoke.
+func (s *Session) publishRecord(ctx context.Context) (bool, error) {
+	// the last segment is uploaded here, others are already in the storage
+	if err := s.segments.finish(ctx); err != nil {
+		return false, fmt.Errorf("failed to upload mix: %w", err)
+	}
+
+	if s.segments.segments() == 0 {
+		s.logger.Info("nobody spoke, voice record is discarded")
+		return false, nil
+	}
+
+	participants := s.participants(ctx)
+
+	s.finishTracks(ctx, participants)
+
+	for _, userTrack := range s.tracks {
+		if err := s.uploadRecordFile(ctx, userTrack.name); err != nil {
+			return false, fmt.Errorf("failed to upload participant track: %w", err)
+		}
+	}
+
+	// streamed tracks would have to be downloaded to be remuxed
+	if s.multitrack != "" && len(s.tracks) != 0 && !s.streaming {
+		name, err := s.writeMultitrack(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to write multitrack file: %w", err)
+		}
+
+		if err = s.uploadRecordFile(ctx, name); err != nil {
+			return false, fmt.Errorf("failed to upload multitrack file: %w", err)
+		}
+
+		s.multitrackName = name
+	}
+
+	// statistics are optional, the record is published without them
+	if err := s.writeStats(ctx); err != nil {
+		s.logger.Error("failed to write packet statistics", slog.Any("error", err))
+	}
+
+	if err := s.publishSpeech(ctx, participants); err != nil {
+		return false, fmt.Errorf("failed to publish speech segments: %w", err)
+	}
+
+	// speaker timeline is optional, the record is published without it
+	hasSpeakers, err := s.writeSpeakerTimeline(ctx, participants)
+	if err != nil {
+		s.logger.Error("failed to write speaker timeline", slog.Any("error", err))
+	}
+
+	s.hasSpeakers = hasSpeakers
+
+	// waveform is optional, the record is published without the preview
+	if s.waveformImage, err = s.writeWaveform(ctx); err != nil {
+		s.logger.Error("failed to write waveform", slog.Any("error", err))
+	}
+
+	// metadata is a sidecar of the uploaded files, the record is published without it
+	if err := s.writeMetadata(ctx, participants); err != nil {
+		s.logger.Error("failed to write record metadata", slog.Any("error", err))
+	}
+
+	s.logger.Info(
+		"voice record uploaded",
+		slog.Any("record_id", s.recordID),
+		slog.Int("tracks", len(s.tracks)),
+		slog.Int("segments", s.segments.segments()),
 	)
 
-	if err = s.recordWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close record file: %w", err)
+	return true, nil
+}
+
+// sendRecordMessage sends message with download links of the record to the voice channel chat.
+// Waveform of the mix is attached as a preview, if it is written.
+func (s *Session) sendRecordMessage(ctx context.Context, intro string) {
+	message := discord.MessageCreate{
+		Content: s.makeRecordMessage(intro),
+	}
+
+	if s.waveformImage != nil {
+		message.Files = []*discord.File{
+			discord.NewFile(waveformName+".png", "Waveform of the mix", bytes.NewReader(s.waveformImage)),
+		}
+	}
+
+	_, _ = s.discordAPI.CreateMessage(s.channelID, message, rest.WithCtx(ctx))
+}
+
+// createRecordFile creates file of the record with given name. In streaming mode the file is
+// uploaded while it is being written, otherwise it is written into the record directory and
+// has to be uploaded by uploadRecordFile after it is closed.
+func (s *Session) createRecordFile(name string) (io.WriteCloser, error) {
+	if s.streaming {
+		// upload outlives any of the session callbacks, it is finished by closing the file
+		return s.recordStorage.UploadRecordStream(context.Background(), s.recordID, recordTTL, name), nil
+	}
+
+	return os.Create(recordFilePath(s.recordDir, name))
+}
+
+// uploadRecordFile uploads closed file of the record. Streamed files are already uploaded.
+func (s *Session) uploadRecordFile(ctx context.Context, name string) error {
+	if s.streaming {
+		return nil
+	}
+
+	return s.recordStorage.UploadRecordFile(ctx, s.recordID, recordTTL, name, recordFilePath(s.recordDir, name))
+}
+
+// writeRecordData writes file of the record with given content and uploads it.
+func (s *Session) writeRecordData(ctx context.Context, name string, data []byte) error {
+	out, err := s.createRecordFile(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = out.Write(data); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	return s.uploadRecordFile(ctx, name)
+}
+
+// rewriteRecordFile replaces closed file of the record with the output of rewrite, which
+// is given the current content of the file. Streamed files are not kept locally, so they
+// can not be rewritten.
+func (s *Session) rewriteRecordFile(
+	ctx context.Context,
+	name string,
+	rewrite func(out io.Writer, in io.Reader) error,
+) error {
+	if s.streaming {
+		return errStreamedFile
+	}
+
+	in, err := s.openRecordFile(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer in.Close() // nolint: errcheck
+
+	path := recordFilePath(s.recordDir, name)
+
+	out, err := os.Create(path + ".rewritten")
+	if err != nil {
+		return err
+	}
+	defer out.Close() // nolint: errcheck
+
+	if err = rewrite(out, in); err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), path)
+}
+
+// openRecordFile opens closed file of the record for reading. Streamed files are downloaded.
+func (s *Session) openRecordFile(ctx context.Context, name string) (io.ReadCloser, error) {
+	if s.streaming {
+		return s.recordStorage.DownloadRecordFile(ctx, s.recordID, name)
+	}
+
+	return os.Open(recordFilePath(s.recordDir, name))
+}
+
+// recordFilePath returns path to the local file of the record.
+func recordFilePath(recordDir, name string) string {
+	return filepath.Join(recordDir, filepath.FromSlash(name))
+}
+
+// closeRecordFiles finalizes mix and all participant tracks.
+func (s *Session) closeRecordFiles() error {
+	for _, userTrack := range s.tracks {
+		if err := userTrack.close(); err != nil {
+			return fmt.Errorf("failed to close track file: %w", err)
+		}
+	}
+
+	if err := s.mixer.close(); err != nil {
+		return fmt.Errorf("failed to close mix file: %w", err)
 	}
 
 	return nil
 }
 
+// makeRecordMessage makes message with download links for the mix playlists and every participant track.
+func (s *Session) makeRecordMessage(intro string) string {
+	var message strings.Builder
+
+	if s.title != "" {
+		message.WriteString("**" + s.title + "**\n")
+	}
+
+	message.WriteString(intro + " Download links (mix is split into parts, open its playlist in a player):\n")
+
+	for _, format := range s.formats {
+		fmt.Fprintf(
+			&message, "- %s - http://localhost:8080/api/voices/%s/%s\n",
+			strings.ToUpper(string(format)), s.recordID.String(), playlistName(format),
+		)
+	}
+
+	if s.multitrackName != "" {
+		fmt.Fprintf(
+			&message, "- All tracks (%s) - http://localhost:8080/api/voices/%s/%s\n",
+			strings.ToUpper(strings.TrimPrefix(multitrackExtensions[s.multitrack], ".")),
+			s.recordID.String(), s.multitrackName,
+		)
+	}
+
+	if s.mixer != nil {
+		for _, output := range s.mixer.trimmed {
+			fmt.Fprintf(
+				&message, "- Without long silence (%s) - http://localhost:8080/api/voices/%s/%s\n",
+				strings.ToUpper(string(output.format)), s.recordID.String(), output.name,
+			)
+		}
+	}
+
+	if s.hasSpeakers {
+		fmt.Fprintf(
+			&message, "- Who spoke when (captions) - http://localhost:8080/api/voices/%s/%s\n",
+			s.recordID.String(), speakersName+".vtt",
+		)
+	}
+
+	if s.waveformImage != nil {
+		fmt.Fprintf(
+			&message, "- Waveform peaks - http://localhost:8080/api/voices/%s/%s\n",
+			s.recordID.String(), waveformPeaksName(1),
+		)
+	}
+
+	message.WriteString("Separate tracks:\n")
+
+	for _, userTrack := range s.tracks {
+		fmt.Fprintf(
+			&message, "- <@%d> - http://localhost:8080/api/voices/%s/%s\n",
+			userTrack.userID, s.recordID.String(), userTrack.name,
+		)
+	}
+
+	return message.String()
+}
+
 func (s *Session) onEvent(event cycle.Event) {
 	switch event.Type() {
 	case EventTypeMemberJoin:
+		if join, ok := event.(EventMemberJoin); ok {
+			s.roster.join(join.UserID, join.DisplayName, join.Time)
+		}
+
 		if members := s.channelMembers.Add(1); members == 1 {
 			s.channelNotEmpty.Store(true)
 		}
 
+	case EventTypeDurationLimit:
+		s.handleDurationLimit()
+
 	case EventTypeMemberLeave:
+		if leave, ok := event.(EventMemberLeave); ok {
+			s.roster.leave(leave.UserID, leave.DisplayName, leave.Time)
+		}
+
 		if (s.channelMembers.Load()-1 == 0) && s.channelNotEmpty.Load() {
 			s.logger.Debug("channel is empty, stopping session")
 
@@ -171,18 +839,3 @@ func (s *Session) onEvent(event cycle.Event) {
 		s.channelMembers.Add(^uint32(0))
 	}
 }
-
-func (s *Session) makeRTPPacket(packet *voice.Packet) *rtp.Packet {
-	return &rtp.Packet{
-		Header: rtp.Header{
-			// these values were taken from Discord API documentation
-			Version:     2,
-			PayloadType: 0x78,
-
-			SequenceNumber: packet.Sequence,
-			Timestamp:      packet.Timestamp,
-			SSRC:           packet.SSRC,
-		},
-		Payload: packet.Opus,
-	}
-}
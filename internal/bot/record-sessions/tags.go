@@ -0,0 +1,195 @@
+package recordsessions
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
+	oggopus "github.com/kvizyx/voicelog/pkg/ogg-opus"
+)
+
+// recordTags describe the record in comments of its Ogg Opus files, so downloaded files
+// can be identified without access to the storage.
+type recordTags struct {
+	title     string
+	startedAt time.Time
+	recordID  uuid.UUID
+	guildID   snowflake.ID
+	channelID snowflake.ID
+}
+
+func (s *Session) recordTags() recordTags {
+	guildName, channelName := s.guildName, s.channelName
+	if guildName == "" {
+		guildName = s.guildID.String()
+	}
+	if channelName == "" {
+		channelName = s.channelID.String()
+	}
+
+	title := fmt.Sprintf("%s / #%s", guildName, channelName)
+	if s.title != "" {
+		title = s.title
+	}
+	if s.part > 1 {
+		title += fmt.Sprintf(" (part %d)", s.part)
+	}
+
+	return recordTags{
+		title:     title,
+		startedAt: s.startedAt,
+		recordID:  s.recordID,
+		guildID:   s.guildID,
+		channelID: s.channelID,
+	}
+}
+
+// mixComments returns comments of the mix files with every participant as an artist.
+func (t recordTags) mixComments(participants []string) []string {
+	return t.comments(t.title, participants)
+}
+
+// trackComments returns comments of the participant track.
+func (t recordTags) trackComments(userID snowflake.ID, name string) []string {
+	if name == "" {
+		name = userID.String()
+	}
+
+	comments := t.comments(fmt.Sprintf("%s - %s", t.title, name), []string{name})
+
+	return append(comments, "VOICELOG_USER_ID="+userID.String())
+}
+
+func (t recordTags) comments(title string, artists []string) []string {
+	comments := []string{"TITLE=" + title}
+
+	for _, artist := range artists {
+		comments = append(comments, "ARTIST="+artist)
+	}
+
+	return append(
+		comments,
+		"DATE="+t.startedAt.UTC().Format(time.RFC3339),
+		"ENCODER=voicelog",
+		"VOICELOG_RECORD_ID="+t.recordID.String(),
+		"VOICELOG_GUILD_ID="+t.guildID.String(),
+		"VOICELOG_CHANNEL_ID="+t.channelID.String(),
+	)
+}
+
+// mixComments returns function making comments of the mix files of the current record. Mix
+// files are created while the recording continues, so they list members who have been in
+// the channel by the moment.
+func (s *Session) mixComments() func() []string {
+	var (
+		tags      = s.recordTags()
+		roster    = s.roster
+		startedAt = s.startedAt
+	)
+
+	return func() []string {
+		presence := roster.presence(startedAt, time.Now())
+
+		participants := make([]participantMetadata, 0, len(presence))
+		for _, participant := range presence {
+			participants = append(participants, participant)
+		}
+
+		slices.SortFunc(participants, func(a, b participantMetadata) int {
+			return cmp.Compare(a.UserID, b.UserID)
+		})
+
+		return tags.mixComments(participantNames(participants))
+	}
+}
+
+// fetchNames fetches names of the guild and the voice channel of the session. Ids are used
+// in place of the names which can not be fetched.
+func (s *Session) fetchNames(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, memberLookupTimeout)
+	defer cancel()
+
+	if guild, err := s.discordAPI.GetGuild(s.guildID, false, rest.WithCtx(ctx)); err == nil {
+		s.guildName = guild.Name
+	} else {
+		s.logger.Debug("failed to get guild", slog.Any("error", err))
+	}
+
+	if channel, err := s.discordAPI.GetChannel(s.channelID, rest.WithCtx(ctx)); err == nil {
+		s.channelName = channel.Name()
+	} else {
+		s.logger.Debug("failed to get voice channel", slog.Any("error", err))
+	}
+}
+
+// finishTracks writes final comments into the participant tracks, now when names of all
+// participants are known, and sets their normalization gain if it is enabled. Streamed
+// tracks are left with the comments they have been created with and are not normalized,
+// as they would have to be downloaded and uploaded once again.
+func (s *Session) finishTracks(ctx context.Context, participants []participantMetadata) {
+	if s.streaming {
+		return
+	}
+
+	var gains map[snowflake.ID]int16
+
+	if s.loudnessTarget != 0 {
+		var err error
+
+		if gains, err = s.normalizationGains(ctx); err != nil {
+			// tracks are still fine, just not normalized
+			s.logger.Error("failed to normalize participant tracks", slog.Any("error", err))
+		}
+	}
+
+	names := make(map[snowflake.ID]string, len(participants))
+	for _, participant := range participants {
+		names[participant.UserID] = participant.Name
+	}
+
+	tags := s.recordTags()
+
+	for _, userTrack := range s.tracks {
+		gain, found := gains[userTrack.userID]
+
+		err := s.retagRecordFile(
+			ctx, userTrack.name,
+			tags.trackComments(userTrack.userID, names[userTrack.userID]),
+			func(head *oggopus.Head) {
+				if found {
+					head.OutputGain = gain
+				}
+			},
+		)
+		if err != nil {
+			s.logger.Error(
+				"failed to write tags of the participant track",
+				slog.Any("user_id", userTrack.userID),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// retagRecordFile replaces comments of the closed Ogg Opus file of the record. Identification
+// header of the file can be changed by editHead, if it is not nil.
+func (s *Session) retagRecordFile(ctx context.Context, name string, comments []string, editHead func(head *oggopus.Head)) error {
+	return s.rewriteRecordFile(ctx, name, func(out io.Writer, in io.Reader) error {
+		return oggopus.Rewrite(out, in, func(head oggopus.Head, tags oggopus.Tags) (oggopus.Head, oggopus.Tags) {
+			if editHead != nil {
+				editHead(&head)
+			}
+
+			tags.Comments = comments
+
+			return head, tags
+		})
+	})
+}
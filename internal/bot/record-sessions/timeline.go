@@ -0,0 +1,73 @@
+package recordsessions
+
+import (
+	"time"
+
+	"github.com/disgoorg/disgo/voice"
+)
+
+const (
+	// clockTolerance is how far RTP clock of the participant may deviate from the
+	// packets arrival time before it is anchored to the session timeline again.
+	clockTolerance = 250 * time.Millisecond
+
+	// talkspurtGap is a pause in packets after which participant is considered as silent.
+	talkspurtGap = 100 * time.Millisecond
+)
+
+// silenceFrame is a 20ms Opus frame of silence, the same one Discord sends when speaker stops talking.
+var silenceFrame = []byte{0xF8, 0xFF, 0xFE}
+
+// speakerClock maps RTP timestamps of the participant to the session timeline. Discord sends
+// nothing while participant is silent and RTP clock of the client is not tied to the wall-clock
+// time, so clock is anchored to the arrival time at the beginning of every talkspurt whenever
+// RTP timestamps disagree with it.
+type speakerClock struct {
+	ssrc            uint32
+	anchorTimestamp uint32
+	anchorPosition  int64
+	lastArrival     int64
+	anchored        bool
+}
+
+// position returns position of the packet on the session timeline (in samples).
+func (c *speakerClock) position(packet *voice.Packet, arrival int64) int64 {
+	defer func() {
+		c.lastArrival = arrival
+	}()
+
+	if !c.anchored || c.ssrc != packet.SSRC {
+		c.anchor(packet, arrival)
+		return arrival
+	}
+
+	position := c.anchorPosition + int64(int32(packet.Timestamp-c.anchorTimestamp))
+
+	newTalkspurt := arrival-c.lastArrival > durationSamples(talkspurtGap)
+	if newTalkspurt && abs(arrival-position) > durationSamples(clockTolerance) {
+		c.anchor(packet, arrival)
+		return arrival
+	}
+
+	return position
+}
+
+func (c *speakerClock) anchor(packet *voice.Packet, arrival int64) {
+	c.ssrc = packet.SSRC
+	c.anchorTimestamp = packet.Timestamp
+	c.anchorPosition = arrival
+	c.anchored = true
+}
+
+// durationSamples returns number of samples (per channel) in the duration.
+func durationSamples(duration time.Duration) int64 {
+	return int64(duration.Seconds() * sampleRate)
+}
+
+func abs(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}
@@ -0,0 +1,107 @@
+package recordsessions
+
+import (
+	"fmt"
+
+	"github.com/disgoorg/disgo/voice"
+	"github.com/disgoorg/snowflake/v2"
+	oggopus "github.com/kvizyx/voicelog/pkg/ogg-opus"
+	"gopkg.in/hraban/opus.v2"
+)
+
+// maxPendingPackets is how many packets of unknown SSRC are kept until
+// the voice gateway tells us which user it belongs to.
+const maxPendingPackets = 50
+
+// track is a voice record of a single channel participant.
+type track struct {
+	userID snowflake.ID
+	name   string // name of the track file within the record
+
+	file    *oggFile
+	decoder *opus.Decoder
+	pcm     []int16
+
+	encoder       *opus.Encoder // encodes concealed audio, created on the first loss
+	encoded       []byte
+	packetSamples int // duration of the last decoded packet (in samples)
+
+	clock        speakerClock
+	nextPosition int64 // position on the session timeline where the written audio ends
+
+	dynamics *speakerDynamics // processes audio of the participant before it is mixed
+
+	stats  packetStats
+	speech speechActivity
+}
+
+func newTrack(createFile createFileFunc, userID snowflake.ID, comments []string) (*track, error) {
+	name := fmt.Sprintf("tracks/%d.ogg", userID)
+
+	decoder, err := opus.NewDecoder(sampleRate, channelsCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create opus decoder: %w", err)
+	}
+
+	// track is cut from the middle of the participant opus stream, so decoder needs some
+	// audio to converge. It is given with silence, that is skipped on playback.
+	out, err := createFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create track file: %w", err)
+	}
+
+	file, err := newOggFile(out, oggopus.DefaultPreSkip, comments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create track file: %w", err)
+	}
+
+	for i := 0; i < oggopus.DefaultPreSkip/frameSamples; i++ {
+		if err = file.writePacket(silenceFrame); err != nil {
+			_ = file.close()
+			return nil, fmt.Errorf("failed to write pre-skip: %w", err)
+		}
+	}
+
+	return &track{
+		userID:  userID,
+		name:    name,
+		file:    file,
+		decoder: decoder,
+		pcm:     make([]int16, maxFrameSamples*channelsCount),
+	}, nil
+}
+
+// writePacket writes packet of given duration (in samples) to the track. Gap between the end of
+// previously written audio and the packet position is filled with silence, so the track stays
+// aligned with the session timeline.
+func (t *track) writePacket(packet []byte, position int64, samples int) error {
+	for ; t.nextPosition+frameSamples <= position; t.nextPosition += frameSamples {
+		if err := t.file.writePacket(silenceFrame); err != nil {
+			return fmt.Errorf("failed to fill silence: %w", err)
+		}
+	}
+
+	if err := t.file.writePacket(packet); err != nil {
+		return err
+	}
+
+	t.nextPosition += int64(samples)
+
+	return nil
+}
+
+// decode decodes packet into interleaved stereo pcm.
+func (t *track) decode(packet *voice.Packet) ([]int16, error) {
+	n, err := t.decoder.Decode(packet.Opus, t.pcm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode opus packet: %w", err)
+	}
+
+	t.packetSamples = n
+
+	return t.pcm[:n*channelsCount], nil
+}
+
+func (t *track) close() error {
+	return t.file.close()
+}
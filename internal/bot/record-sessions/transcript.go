@@ -0,0 +1,201 @@
+package recordsessions
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/kvizyx/voicelog/internal/transcription"
+	"github.com/kvizyx/voicelog/pkg/logger"
+)
+
+const (
+	// transcriptName is a base name of the transcript files, which are written as JSON and plain text.
+	transcriptName = "transcript"
+
+	transcriptionTimeout = 30 * time.Minute
+
+	// transcriptionQueueSize is how many published records may wait for transcription,
+	// records published while the queue is full are not transcribed.
+	transcriptionQueueSize = 16
+)
+
+// transcript is a timestamped text of everything said in the record.
+type transcript struct {
+	RecordID string              `json:"record_id"`
+	Segments []transcriptSegment `json:"segments"`
+}
+
+type transcriptSegment struct {
+	Start  float64      `json:"start"` // offset from the beginning of the record (in seconds)
+	End    float64      `json:"end"`   // in seconds
+	UserID snowflake.ID `json:"user_id"`
+	Name   string       `json:"name"`
+	Text   string       `json:"text"`
+}
+
+// transcriptionQueue transcribes published records one at a time, apart from the sessions, so
+// the guild can be recorded again while its previous record is transcribed. Files of the queued
+// record belong to the queue, they are removed once the record is transcribed.
+type transcriptionQueue struct {
+	logger  logger.Logger
+	records chan *Session
+	done    chan struct{}
+}
+
+func newTranscriptionQueue(logger logger.Logger) *transcriptionQueue {
+	return &transcriptionQueue{
+		logger:  logger,
+		records: make(chan *Session, transcriptionQueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// run transcribes queued records until the context is canceled. Files of the records left
+// in the queue are removed by the recovery on the next start.
+func (q *transcriptionQueue) run(ctx context.Context) {
+	defer close(q.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case record := <-q.records:
+			record.transcribeRecord(ctx)
+
+			_ = os.RemoveAll(record.recordDir)
+		}
+	}
+}
+
+// add queues the record for transcription. It reports whether the record is queued.
+func (q *transcriptionQueue) add(record *Session) bool {
+	select {
+	case q.records <- record:
+		return true
+	default:
+		q.logger.Warn("too many records wait for transcription, record is not transcribed", slog.Any("record_id", record.recordID))
+		return false
+	}
+}
+
+// wait waits for the queue to stop running.
+func (q *transcriptionQueue) wait() {
+	<-q.done
+}
+
+// transcribeRecord transcribes every participant track of the published record, uploads
+// the transcript and sends its link to the voice channel chat. Tracks are aligned with
+// the record timeline, so their transcripts are merged as they are.
+func (s *Session) transcribeRecord(ctx context.Context) {
+	if s.transcriber == nil || len(s.tracks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, transcriptionTimeout)
+	defer cancel()
+
+	startedAt := time.Now()
+
+	names := make(map[snowflake.ID]string, len(s.tracks))
+	for _, participant := range s.participants(ctx) {
+		names[participant.UserID] = participant.Name
+	}
+
+	result := transcript{
+		RecordID: s.recordID.String(),
+		Segments: make([]transcriptSegment, 0),
+	}
+
+	for _, userTrack := range s.tracks {
+		segments, err := s.transcribeTrack(ctx, userTrack)
+		if err != nil {
+			// transcripts of other participants are still useful
+			s.logger.Error(
+				"failed to transcribe participant track",
+				slog.Any("user_id", userTrack.userID),
+				slog.Any("error", err),
+			)
+
+			continue
+		}
+
+		for _, segment := range segments {
+			result.Segments = append(result.Segments, transcriptSegment{
+				Start:  segment.Start.Seconds(),
+				End:    segment.End.Seconds(),
+				UserID: userTrack.userID,
+				Name:   names[userTrack.userID],
+				Text:   segment.Text,
+			})
+		}
+	}
+
+	slices.SortFunc(result.Segments, func(a, b transcriptSegment) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		s.logger.Error("failed to marshal transcript", slog.Any("error", err))
+		return
+	}
+
+	if err = s.writeRecordData(ctx, transcriptName+".json", data); err != nil {
+		s.logger.Error("failed to upload transcript", slog.Any("error", err))
+		return
+	}
+
+	if err = s.writeRecordData(ctx, transcriptName+".txt", makeTranscriptText(result.Segments)); err != nil {
+		s.logger.Error("failed to upload transcript", slog.Any("error", err))
+		return
+	}
+
+	s.logger.Info(
+		"voice record transcribed",
+		slog.Any("record_id", s.recordID),
+		slog.Int("segments", len(result.Segments)),
+		slog.Duration("took", time.Since(startedAt)),
+	)
+
+	_, _ = s.discordAPI.CreateMessage(
+		s.channelID,
+		discord.MessageCreate{
+			Content: fmt.Sprintf(
+				"Transcript of the recording is ready - http://localhost:8080/api/voices/%s/%s",
+				s.recordID.String(), transcriptName+".txt",
+			),
+		},
+		rest.WithCtx(ctx),
+	)
+}
+
+func (s *Session) transcribeTrack(ctx context.Context, userTrack *track) ([]transcription.Segment, error) {
+	in, err := s.openRecordFile(ctx, userTrack.name)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close() // nolint: errcheck
+
+	return s.transcriber.Transcribe(ctx, in)
+}
+
+// makeTranscriptText makes transcript readable as plain text, a line per segment.
+func makeTranscriptText(segments []transcriptSegment) []byte {
+	var text strings.Builder
+
+	for _, segment := range segments {
+		fmt.Fprintf(&text, "[%s] %s: %s\n", formatCueTime(segment.Start, "."), segment.Name, segment.Text)
+	}
+
+	return []byte(text.String())
+}
@@ -0,0 +1,198 @@
+package recordsessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
+	"github.com/kvizyx/voicelog/internal/transcription"
+	"github.com/kvizyx/voicelog/pkg/logger"
+)
+
+type discardLogger struct{}
+
+func (discardLogger) Info(string, ...any)         {}
+func (discardLogger) Error(string, ...any)        {}
+func (discardLogger) Debug(string, ...any)        {}
+func (discardLogger) Warn(string, ...any)         {}
+func (l discardLogger) With(...any) logger.Logger { return l }
+
+// memoryStorage keeps uploaded record files in memory.
+type memoryStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (m *memoryStorage) UploadRecordFile(_ context.Context, _ uuid.UUID, _ time.Duration, name, filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[name] = data
+
+	return nil
+}
+
+func (m *memoryStorage) UploadRecordStream(context.Context, uuid.UUID, time.Duration, string) io.WriteCloser {
+	panic("record files are not streamed")
+}
+
+func (m *memoryStorage) DownloadRecordFile(context.Context, uuid.UUID, string) (io.ReadCloser, error) {
+	return nil, fs.ErrNotExist
+}
+
+// messages records messages sent to the channel chat.
+type messages struct {
+	rest.Rest
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *messages) CreateMessage(_ snowflake.ID, message discord.MessageCreate, _ ...rest.RequestOpt) (*discord.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, message.Content)
+
+	return &discord.Message{}, nil
+}
+
+// newTranscribedSession returns session of the published record of two participants, which
+// tracks are transcribed by the fake transcriber into the given segments.
+func newTranscribedSession(t *testing.T, segments []transcription.Segment) (*Session, *memoryStorage, *messages) {
+	t.Helper()
+
+	storage := &memoryStorage{files: make(map[string][]byte)}
+	chat := &messages{}
+
+	startedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	s := &Session{
+		logger:        discardLogger{},
+		recordStorage: storage,
+		discordAPI:    chat,
+		recordID:      uuid.MustParse("6f1b1c1e-8f5e-4a55-9d4e-2a7a3c0e9b11"),
+		recordDir:     t.TempDir(),
+		startedAt:     startedAt,
+		endedAt:       startedAt.Add(time.Minute),
+		roster:        newRoster(),
+		tracks:        make(map[snowflake.ID]*track),
+		transcriber:   &transcription.Fake{Segments: segments},
+	}
+
+	for userID, name := range map[snowflake.ID]string{2: "Bob", 1: "Alice"} {
+		s.roster.join(userID, name, startedAt)
+
+		userTrack := &track{userID: userID, name: "tracks/" + userID.String() + ".ogg"}
+		s.tracks[userID] = userTrack
+
+		path := recordFilePath(s.recordDir, userTrack.name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("OggS"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s, storage, chat
+}
+
+func TestTranscribeRecord(t *testing.T) {
+	s, storage, chat := newTranscribedSession(t, []transcription.Segment{
+		{Start: 1500 * time.Millisecond, End: 3 * time.Second, Text: "hello"},
+		{Start: 62 * time.Minute, End: 62*time.Minute + 250*time.Millisecond, Text: "bye"},
+	})
+
+	s.transcribeRecord(context.Background())
+
+	var result transcript
+	if err := json.Unmarshal(storage.files[transcriptName+".json"], &result); err != nil {
+		t.Fatalf("failed to parse transcript: %v", err)
+	}
+
+	// segments of both tracks are merged in order of their start, speakers in order of ids
+	want := []transcriptSegment{
+		{Start: 1.5, End: 3, UserID: 1, Name: "Alice", Text: "hello"},
+		{Start: 1.5, End: 3, UserID: 2, Name: "Bob", Text: "hello"},
+		{Start: 3720, End: 3720.25, UserID: 1, Name: "Alice", Text: "bye"},
+		{Start: 3720, End: 3720.25, UserID: 2, Name: "Bob", Text: "bye"},
+	}
+
+	if result.RecordID != s.recordID.String() {
+		t.Errorf("record id = %q, want %q", result.RecordID, s.recordID)
+	}
+
+	if len(result.Segments) != len(want) {
+		t.Fatalf("transcript has %d segments, want %d: %+v", len(result.Segments), len(want), result.Segments)
+	}
+
+	for i := range want {
+		if result.Segments[i] != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, result.Segments[i], want[i])
+		}
+	}
+
+	wantText := "[00:00:01.500] Alice: hello\n" +
+		"[00:00:01.500] Bob: hello\n" +
+		"[01:02:00.000] Alice: bye\n" +
+		"[01:02:00.000] Bob: bye\n"
+
+	if text := string(storage.files[transcriptName+".txt"]); text != wantText {
+		t.Errorf("transcript text = %q, want %q", text, wantText)
+	}
+
+	if len(chat.sent) != 1 {
+		t.Errorf("%d messages are sent, want the transcript link", len(chat.sent))
+	}
+}
+
+func TestTranscriptionQueue(t *testing.T) {
+	s, storage, _ := newTranscribedSession(t, nil)
+
+	q := newTranscriptionQueue(discardLogger{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.run(ctx)
+
+	if !q.add(s) {
+		t.Fatal("record is not queued")
+	}
+
+	// files of the record are removed once it is transcribed
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(s.recordDir); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("files of the transcribed record are not removed")
+		}
+	}
+
+	cancel()
+	q.wait()
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if _, found := storage.files[transcriptName+".json"]; !found {
+		t.Error("transcript is not uploaded")
+	}
+}
@@ -0,0 +1,138 @@
+package recordsessions
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/kvizyx/voicelog/internal/audio"
+)
+
+const speechName = "speech.json"
+
+const (
+	// speechThreshold is the level of the frame (in dBFS) above which it is considered speech.
+	speechThreshold = -45.0
+	// speechHangover is the longest pause which does not split speech, so segments are not
+	// broken between words.
+	speechHangover = 500 * time.Millisecond
+)
+
+// isSpeech reports whether interleaved pcm contains speech, judging by its energy.
+func isSpeech(pcm []int16) bool {
+	if len(pcm) == 0 {
+		return false
+	}
+
+	var energy float64
+	for _, sample := range pcm {
+		value := float64(sample) / math.MaxInt16
+		energy += value * value
+	}
+
+	level := 10 * math.Log10(energy/float64(len(pcm))+1e-12)
+
+	return level > speechThreshold
+}
+
+// speechActivity collects parts of the timeline which contain speech.
+type speechActivity struct {
+	spans [][2]int64 // start and end positions (in samples), in order
+}
+
+// add marks part of the timeline as speech. Part which follows the previous one closer than
+// speechHangover extends it.
+func (a *speechActivity) add(start, end int64) {
+	if n := len(a.spans); n > 0 && start <= a.spans[n-1][1]+durationSamples(speechHangover) {
+		a.spans[n-1][1] = max(a.spans[n-1][1], end)
+		return
+	}
+
+	a.spans = append(a.spans, [2]int64{start, end})
+}
+
+func (a *speechActivity) segments() []speechSegment {
+	segments := make([]speechSegment, 0, len(a.spans))
+	for _, span := range a.spans {
+		segments = append(segments, speechSegment{
+			Start: float64(span[0]) / sampleRate,
+			End:   float64(span[1]) / sampleRate,
+		})
+	}
+
+	return segments
+}
+
+// duration returns total duration of speech (in samples).
+func (a *speechActivity) duration() int64 {
+	var duration int64
+	for _, span := range a.spans {
+		duration += span[1] - span[0]
+	}
+
+	return duration
+}
+
+type speechSegment struct {
+	Start float64 `json:"start"` // offset from the beginning of the record (in seconds)
+	End   float64 `json:"end"`   // in seconds
+}
+
+// speechReport lists segments of the record where people talk.
+type speechReport struct {
+	Segments       []speechSegment            `json:"segments"`     // where anyone talks
+	Participants   map[string][]speechSegment `json:"participants"` // by user id
+	SpeechDuration float64                    `json:"speech_duration"`
+	TrimmedMix     map[string]string          `json:"trimmed_mix,omitempty"`  // names of the mix files without long silence by format
+	TrimSilence    float64                    `json:"trim_silence,omitempty"` // longest silence kept in the trimmed mix (in seconds)
+}
+
+// publishSpeech uploads the mix without long silence, if it is written, and the list of speech segments.
+func (s *Session) publishSpeech(ctx context.Context, participants []participantMetadata) error {
+	// speech is not detected in the recovered records
+	if s.mixer == nil {
+		return nil
+	}
+
+	report := speechReport{
+		Segments:       s.mixer.speech.segments(),
+		Participants:   make(map[string][]speechSegment, len(s.tracks)),
+		SpeechDuration: float64(s.mixer.speech.duration()) / sampleRate,
+	}
+
+	for _, userTrack := range s.tracks {
+		report.Participants[userTrack.userID.String()] = userTrack.speech.segments()
+	}
+
+	if len(s.mixer.trimmed) != 0 {
+		report.TrimmedMix = make(map[string]string, len(s.mixer.trimmed))
+		report.TrimSilence = s.trimSilence.Seconds()
+	}
+
+	for _, output := range s.mixer.trimmed {
+		// participants who joined after the file has been created are added, streamed file keeps
+		// the participants it has been created with
+		if output.format == audio.FormatOpus && !s.streaming {
+			comments := s.recordTags().mixComments(participantNames(participants))
+
+			if err := s.retagRecordFile(ctx, output.name, comments, nil); err != nil {
+				s.logger.Error("failed to write tags of the trimmed mix", slog.Any("error", err))
+			}
+		}
+
+		if err := s.uploadRecordFile(ctx, output.name); err != nil {
+			return err
+		}
+
+		report.TrimmedMix[string(output.format)] = output.name
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.writeRecordData(ctx, speechName, data)
+}
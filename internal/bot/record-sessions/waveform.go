@@ -0,0 +1,103 @@
+package recordsessions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/kvizyx/voicelog/internal/audio"
+	"github.com/kvizyx/voicelog/pkg/waveform"
+)
+
+const (
+	// waveformName is a base name of the waveform files. Peaks are written as JSON for every
+	// resolution in waveformZooms, and the preview image is written as PNG.
+	waveformName = "waveform"
+
+	// waveformSamplesPerPixel is the finest resolution of the waveform peaks.
+	waveformSamplesPerPixel = 256
+
+	waveformImageWidth  = 1200
+	waveformImageHeight = 200
+)
+
+// waveformZooms are resolutions of the waveform peaks, relative to waveformSamplesPerPixel.
+var waveformZooms = []int{1, 4, 16, 64}
+
+// waveformSources are formats of the mix segments which waveform is computed from, in order of preference.
+var waveformSources = []audio.Format{audio.FormatOpus, audio.FormatWAV}
+
+// writeWaveform writes waveform peaks of the mix and its preview image, which is returned.
+// Peaks are computed by decoding the uploaded mix segments, so the recovered record has
+// the waveform too. Nothing is written if the mix has no format which can be decoded.
+func (s *Session) writeWaveform(ctx context.Context) ([]byte, error) {
+	index := slices.IndexFunc(waveformSources, func(format audio.Format) bool {
+		return slices.Contains(s.formats, format)
+	})
+	if index == -1 {
+		s.logger.Debug("waveform is not written, mix can not be decoded", slog.Any("formats", s.formats))
+		return nil, nil
+	}
+
+	peaks, err := s.mixPeaks(ctx, waveformSources[index])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mix: %w", err)
+	}
+
+	for _, zoom := range waveformZooms {
+		data, err := peaks.Zoom(zoom).MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		if err = s.writeRecordData(ctx, waveformPeaksName(zoom), data); err != nil {
+			return nil, err
+		}
+	}
+
+	var image bytes.Buffer
+
+	if err = peaks.WritePNG(&image, waveformImageWidth, waveformImageHeight); err != nil {
+		return nil, fmt.Errorf("failed to render waveform image: %w", err)
+	}
+
+	if err = s.writeRecordData(ctx, waveformName+".png", image.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return image.Bytes(), nil
+}
+
+// mixPeaks decodes segments of the mix in given format one after another and returns their
+// peaks. Segments are downloaded, as they are removed from the disk once uploaded.
+func (s *Session) mixPeaks(ctx context.Context, format audio.Format) (*waveform.Peaks, error) {
+	peaks := waveform.NewPeaks(sampleRate, waveformSamplesPerPixel)
+
+	for _, segment := range s.segments.uploaded() {
+		in, err := s.recordStorage.DownloadRecordFile(ctx, s.recordID, segment.Files[string(format)])
+		if err != nil {
+			return nil, err
+		}
+
+		err = audio.DecodeFormat(format, in, func(pcm []int16) error {
+			peaks.Write(pcm, channelsCount)
+			return nil
+		})
+		_ = in.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode segment %d: %w", segment.Index, err)
+		}
+	}
+
+	peaks.Finish()
+
+	return peaks, nil
+}
+
+// waveformPeaksName returns name of the waveform peaks file of given resolution.
+func waveformPeaksName(zoom int) string {
+	return fmt.Sprintf("%s-%d.json", waveformName, waveformSamplesPerPixel*zoom)
+}
@@ -0,0 +1,194 @@
+// Package scheduler starts recordings of voice channels on schedules from the guild settings.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/google/uuid"
+	recordsessions "github.com/kvizyx/voicelog/internal/bot/record-sessions"
+	"github.com/kvizyx/voicelog/internal/config"
+	"github.com/kvizyx/voicelog/pkg/cron"
+	"github.com/kvizyx/voicelog/pkg/logger"
+)
+
+type Scheduler struct {
+	Params
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type Params struct {
+	Logger          logger.Logger
+	SessionsManager *recordsessions.SessionsManager
+	Guilds          config.Guilds
+
+	// Members returns join events of the humans which are in the voice channel.
+	Members func(guildID, channelID snowflake.ID) []recordsessions.EventMemberJoin
+}
+
+// schedule is a parsed recording schedule of the guild.
+type schedule struct {
+	guildID   snowflake.ID
+	channelID snowflake.ID
+	cron      cron.Schedule
+	location  *time.Location
+	duration  time.Duration
+	title     string
+}
+
+func New(params Params) *Scheduler {
+	return &Scheduler{Params: params}
+}
+
+// Start parses schedules of all guilds and runs them in background until Stop is called.
+func (s *Scheduler) Start() error {
+	schedules := make([]schedule, 0)
+
+	for guild, settings := range s.Guilds.Guilds {
+		guildID, err := snowflake.Parse(guild)
+		if err != nil {
+			return fmt.Errorf("invalid guild id %q: %w", guild, err)
+		}
+
+		for _, value := range settings.Schedules {
+			parsed, err := parseSchedule(guildID, value)
+			if err != nil {
+				return fmt.Errorf("invalid schedule of guild %s: %w", guild, err)
+			}
+
+			schedules = append(schedules, parsed)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, parsed := range schedules {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+
+			s.run(ctx, parsed)
+		}()
+	}
+
+	return nil
+}
+
+// Stop stops starting recordings. Recordings which have been started are left to the sessions manager.
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	s.wg.Wait()
+}
+
+func parseSchedule(guildID snowflake.ID, value config.Schedule) (schedule, error) {
+	channelID, err := snowflake.Parse(value.Channel)
+	if err != nil {
+		return schedule{}, fmt.Errorf("invalid channel id %q: %w", value.Channel, err)
+	}
+
+	parsed, err := cron.Parse(value.Cron)
+	if err != nil {
+		return schedule{}, err
+	}
+
+	// empty name is UTC
+	location, err := time.LoadLocation(value.Timezone)
+	if err != nil {
+		return schedule{}, fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	return schedule{
+		guildID:   guildID,
+		channelID: channelID,
+		cron:      parsed,
+		location:  location,
+		duration:  value.Duration,
+		title:     value.Title,
+	}, nil
+}
+
+// run records the channel every time the schedule comes.
+func (s *Scheduler) run(ctx context.Context, scheduled schedule) {
+	scheduleLogger := s.Logger.With(
+		slog.Any("guild_id", scheduled.guildID),
+		slog.Any("channel_id", scheduled.channelID),
+	)
+
+	for {
+		next, err := scheduled.cron.Next(time.Now().In(scheduled.location))
+		if err != nil {
+			scheduleLogger.Warn("recording schedule never comes", slog.Any("error", err))
+			return
+		}
+
+		scheduleLogger.Debug("next scheduled recording", slog.Time("start", next))
+
+		if !sleep(ctx, time.Until(next)) {
+			return
+		}
+
+		recordID, err := s.SessionsManager.Spawn(recordsessions.SpawnParams{
+			GuildID:   scheduled.guildID,
+			ChannelID: scheduled.channelID,
+			Members:   s.Members(scheduled.guildID, scheduled.channelID),
+			Title:     scheduled.title,
+		})
+		if errors.Is(err, recordsessions.ErrAlreadyRecording) {
+			scheduleLogger.Info("guild is already recorded, scheduled recording is skipped")
+			continue
+		}
+
+		if err != nil {
+			scheduleLogger.Error("failed to spawn scheduled recording session", slog.Any("error", err))
+			continue
+		}
+
+		scheduleLogger.Info("scheduled recording started")
+
+		if scheduled.duration == 0 {
+			continue
+		}
+
+		if !sleep(ctx, scheduled.duration) {
+			return
+		}
+
+		s.stop(scheduleLogger, scheduled.guildID, recordID)
+	}
+}
+
+// stop stops the scheduled recording, unless the session has been replaced by another one.
+func (s *Scheduler) stop(scheduleLogger logger.Logger, guildID snowflake.ID, recordID uuid.UUID) {
+	status, err := s.SessionsManager.Status(guildID)
+	if err != nil || status.FirstRecordID != recordID {
+		return
+	}
+
+	if err = s.SessionsManager.Stop(guildID); err != nil && !errors.Is(err, recordsessions.ErrStopping) {
+		scheduleLogger.Error("failed to stop scheduled recording session", slog.Any("error", err))
+	}
+}
+
+// sleep waits for the duration, it reports false if the context is done before.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -12,9 +12,21 @@ type Config struct {
 	Env      string `env:"ENV"`
 	BotToken string `env:"BOT_TOKEN"`
 
-	S3      S3
-	HTTP    HTTP
-	Discord Discord
+	// GuildsPath is an optional path to the YAML file with recording settings of guilds.
+	GuildsPath string `env:"GUILDS_CONFIG_PATH"`
+	// RecoveryNotice enables notice with download links of the record recovered after the crash.
+	RecoveryNotice bool `env:"RECOVERY_NOTICE"`
+	// StreamingUpload enables upload of record files while they are recorded, so that no
+	// scratch space is needed. Files being recorded can not be recovered after the crash,
+	// participant tracks are neither normalized nor retagged with final names, and the
+	// multitrack file is not written, as all of them need the tracks kept on the local disk.
+	StreamingUpload bool `env:"STREAMING_UPLOAD"`
+
+	S3            S3
+	HTTP          HTTP
+	Discord       Discord
+	Transcription Transcription
+	Guilds        Guilds
 }
 
 type S3 struct {
@@ -37,6 +49,17 @@ type Discord struct {
 	ClientSecret string `env:"DISCORD_CLIENT_SECRET"`
 }
 
+type Transcription struct {
+	// Engine transcribes records when they are finished: "whisper" (whisper.cpp) or "fake".
+	// Records are not transcribed if empty.
+	Engine string `env:"TRANSCRIPTION_ENGINE"`
+	// Language is a spoken language code, it is detected automatically if empty.
+	Language string `env:"TRANSCRIPTION_LANGUAGE"`
+
+	WhisperBinary string `env:"WHISPER_BINARY"`
+	WhisperModel  string `env:"WHISPER_MODEL"`
+}
+
 func New(path string) (Config, error) {
 	var (
 		config Config
@@ -56,5 +79,17 @@ func New(path string) (Config, error) {
 		return Config{}, fmt.Errorf("failed to read config: %w", err)
 	}
 
+	if len(config.GuildsPath) != 0 {
+		if err := cleanenv.ReadConfig(config.GuildsPath, &config.Guilds); err != nil {
+			return Config{}, fmt.Errorf("failed to read guilds config: %w", err)
+		}
+	}
+
+	config.Guilds.setDefaults()
+
+	if err := config.Guilds.validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid guilds config: %w", err)
+	}
+
 	return config, nil
 }
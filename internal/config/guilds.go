@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Guilds is a recording settings of guilds. Settings which are not set for
+// the guild are taken from the defaults. Settings which can be disabled by zero
+// are pointers, so the guild can disable what is enabled by the defaults.
+type Guilds struct {
+	Defaults GuildSettings            `yaml:"defaults"`
+	Guilds   map[string]GuildSettings `yaml:"guilds"` // by guild id
+}
+
+type GuildSettings struct {
+	// Formats of the mix file: "ogg" (Opus), "wav" or "flac".
+	Formats []string `yaml:"formats"`
+	// Multitrack is a container of the file with a separate track per participant:
+	// "mka" (Matroska) or "webm". Multitrack file is not written if empty.
+	Multitrack string `yaml:"multitrack"`
+	// SegmentDuration is a duration of mix parts, which are uploaded while recording continues.
+	SegmentDuration time.Duration `yaml:"segment_duration"`
+	// MaxDuration is a maximum duration of the record. Duration is not limited if zero.
+	MaxDuration *time.Duration `yaml:"max_duration"`
+	// OnMaxDuration is what happens when the record reaches maximum duration: "stop" the
+	// session with a warning or "split" the record into linked parts and continue recording.
+	OnMaxDuration string `yaml:"on_max_duration"`
+	// TrimSilence enables the mix without silence longer than this duration, which is
+	// written along with the full one. It is not written if zero.
+	TrimSilence *time.Duration `yaml:"trim_silence"`
+	// LoudnessTarget is integrated loudness (in LUFS, EBU R128 recommends -23) participant
+	// tracks are normalized to when the session stops. Tracks are not normalized if zero.
+	LoudnessTarget *float64 `yaml:"loudness_target"`
+	// TruePeakLimit is the highest true peak (in dBTP) of the normalized track. Audio is not
+	// limited: normalization gain is reduced instead, so the track may stay below the target.
+	TruePeakLimit *float64 `yaml:"true_peak_limit"`
+	// NoiseGate is a level (in dBFS) below which audio of the speaker is muted in the mix.
+	// Gate is disabled if zero.
+	NoiseGate *float64 `yaml:"noise_gate"`
+	// AutoGainTarget is a level (in dBFS) speech of every speaker is brought to in the mix.
+	// Automatic gain is disabled if zero.
+	AutoGainTarget *float64 `yaml:"auto_gain_target"`
+	// RecordRoles are ids of roles whose members may start recording with the record command,
+	// besides those who can manage channels. They belong to the guild like the auto record roles.
+	RecordRoles []string `yaml:"record_roles"`
+	// AutoRecord decides when voice channels are recorded without the record command.
+	AutoRecord AutoRecord `yaml:"auto_record"`
+	// Schedules are recordings started on schedule. They belong to the guild, so they
+	// are not taken from the defaults.
+	Schedules []Schedule `yaml:"schedules"`
+}
+
+// AutoRecord is a policy of recording voice channels automatically.
+type AutoRecord struct {
+	// Policy is when the channel is recorded: "new_channel" when it is created, "first_join"
+	// when the first human joins it, "min_members" when at least MinMembers humans are in it,
+	// "role" when a member with any of Roles is in it, or "never". Occupied channels are also
+	// checked on the start, when "new_channel" picks up recordings interrupted by the crash.
+	Policy string `yaml:"policy"`
+	// MinMembers is a number of humans in the channel for the "min_members" policy.
+	MinMembers *int `yaml:"min_members"`
+	// Roles are ids of roles for the "role" policy.
+	Roles []string `yaml:"roles"`
+	// Channels are ids of the only channels recorded automatically, all if empty.
+	Channels []string `yaml:"channels"`
+	// IgnoredChannels are ids of channels never recorded automatically.
+	IgnoredChannels []string `yaml:"ignored_channels"`
+	// ScheduledEvents enables recording channels of Discord scheduled events while they are active,
+	// regardless of the policy.
+	ScheduledEvents *bool `yaml:"scheduled_events"`
+}
+
+// Schedule is a recording of the voice channel started on schedule.
+type Schedule struct {
+	// Channel is an id of the voice channel.
+	Channel string `yaml:"channel"`
+	// Cron is a five-field cron expression of when the recording starts.
+	Cron string `yaml:"cron"`
+	// Timezone is a name of the time zone of Cron, UTC if empty.
+	Timezone string `yaml:"timezone"`
+	// Duration of the recording, it goes on until the channel is empty if zero.
+	Duration time.Duration `yaml:"duration"`
+	// Title of the record, made of the guild and channel names if empty.
+	Title string `yaml:"title"`
+}
+
+// Settings returns recording settings of the guild.
+func (g Guilds) Settings(guildID snowflake.ID) GuildSettings {
+	settings, found := g.Guilds[guildID.String()]
+	if !found {
+		return g.Defaults
+	}
+
+	if len(settings.Formats) == 0 {
+		settings.Formats = g.Defaults.Formats
+	}
+	if settings.Multitrack == "" {
+		settings.Multitrack = g.Defaults.Multitrack
+	}
+	if settings.SegmentDuration == 0 {
+		settings.SegmentDuration = g.Defaults.SegmentDuration
+	}
+	if settings.MaxDuration == nil {
+		settings.MaxDuration = g.Defaults.MaxDuration
+	}
+	if settings.OnMaxDuration == "" {
+		settings.OnMaxDuration = g.Defaults.OnMaxDuration
+	}
+	if settings.TrimSilence == nil {
+		settings.TrimSilence = g.Defaults.TrimSilence
+	}
+	if settings.LoudnessTarget == nil {
+		settings.LoudnessTarget = g.Defaults.LoudnessTarget
+	}
+	if settings.TruePeakLimit == nil {
+		settings.TruePeakLimit = g.Defaults.TruePeakLimit
+	}
+	if settings.NoiseGate == nil {
+		settings.NoiseGate = g.Defaults.NoiseGate
+	}
+	if settings.AutoGainTarget == nil {
+		settings.AutoGainTarget = g.Defaults.AutoGainTarget
+	}
+	// roles and channels belong to the guild, so only the policy itself is inherited
+	if settings.AutoRecord.Policy == "" {
+		settings.AutoRecord.Policy = g.Defaults.AutoRecord.Policy
+	}
+	if settings.AutoRecord.MinMembers == nil {
+		settings.AutoRecord.MinMembers = g.Defaults.AutoRecord.MinMembers
+	}
+	if settings.AutoRecord.ScheduledEvents == nil {
+		settings.AutoRecord.ScheduledEvents = g.Defaults.AutoRecord.ScheduledEvents
+	}
+
+	return settings
+}
+
+func (g *Guilds) setDefaults() {
+	if len(g.Defaults.Formats) == 0 {
+		g.Defaults.Formats = []string{"ogg"}
+	}
+	if g.Defaults.SegmentDuration == 0 {
+		g.Defaults.SegmentDuration = 5 * time.Minute
+	}
+	if g.Defaults.MaxDuration == nil {
+		maxDuration := 1 * time.Hour
+		g.Defaults.MaxDuration = &maxDuration
+	}
+	if g.Defaults.OnMaxDuration == "" {
+		g.Defaults.OnMaxDuration = "stop"
+	}
+	if g.Defaults.TrimSilence == nil {
+		g.Defaults.TrimSilence = new(time.Duration)
+	}
+	if g.Defaults.LoudnessTarget == nil {
+		g.Defaults.LoudnessTarget = new(float64)
+	}
+	if g.Defaults.TruePeakLimit == nil {
+		truePeakLimit := -1.0
+		g.Defaults.TruePeakLimit = &truePeakLimit
+	}
+	if g.Defaults.NoiseGate == nil {
+		g.Defaults.NoiseGate = new(float64)
+	}
+	if g.Defaults.AutoGainTarget == nil {
+		g.Defaults.AutoGainTarget = new(float64)
+	}
+	if g.Defaults.AutoRecord.Policy == "" {
+		g.Defaults.AutoRecord.Policy = "new_channel"
+	}
+	if g.Defaults.AutoRecord.MinMembers == nil {
+		minMembers := 2
+		g.Defaults.AutoRecord.MinMembers = &minMembers
+	}
+	if g.Defaults.AutoRecord.ScheduledEvents == nil {
+		g.Defaults.AutoRecord.ScheduledEvents = new(bool)
+	}
+}
+
+// validate checks settings which are not checked when the recording is started, as their
+// mistakes only show up in the middle of the recording.
+func (g Guilds) validate() error {
+	if err := g.Defaults.validate(); err != nil {
+		return fmt.Errorf("invalid default settings: %w", err)
+	}
+
+	for guildID, settings := range g.Guilds {
+		if err := settings.validate(); err != nil {
+			return fmt.Errorf("invalid settings of guild %s: %w", guildID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s GuildSettings) validate() error {
+	if s.MaxDuration != nil && *s.MaxDuration < 0 {
+		return fmt.Errorf("negative max_duration %s", *s.MaxDuration)
+	}
+
+	switch s.OnMaxDuration {
+	case "", "stop", "split":
+	default:
+		return fmt.Errorf("unknown on_max_duration %q", s.OnMaxDuration)
+	}
+
+	return nil
+}
@@ -1 +1,27 @@
 package discord
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kvizyx/voicelog/internal/bot"
+	"github.com/kvizyx/voicelog/internal/config"
+)
+
+type Handler struct {
+	config config.Discord
+}
+
+func NewHandler(config config.Discord) Handler {
+	return Handler{config: config}
+}
+
+// InviteLink redirects to the page for inviting bot to the guild.
+func (h *Handler) InviteLink(w http.ResponseWriter, r *http.Request) {
+	inviteLink := fmt.Sprintf(
+		"https://discord.com/oauth2/authorize?client_id=%s&permissions=%d&scope=bot",
+		h.config.ClientID, bot.Permissions,
+	)
+
+	http.Redirect(w, r, inviteLink, http.StatusFound)
+}
@@ -1 +1,137 @@
 package records
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kvizyx/voicelog/internal/audio"
+)
+
+type RecordDownloader interface {
+	DownloadRecordFile(ctx context.Context, recordID uuid.UUID, name string) (io.ReadCloser, error)
+	ListRecordFiles(ctx context.Context, recordID uuid.UUID) ([]string, error)
+	// DownloadLegacyVoice downloads record made before records have been split into files.
+	DownloadLegacyVoice(ctx context.Context, voiceID uuid.UUID) (io.ReadCloser, error)
+}
+
+type Handler struct {
+	recordDownloader RecordDownloader
+}
+
+func NewHandler(recordDownloader RecordDownloader) Handler {
+	return Handler{recordDownloader: recordDownloader}
+}
+
+// ListFiles lists all files of the voice record. Record made before records have been split
+// into files is served as it is, so the old download links keep working.
+func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	recordID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid voice id", http.StatusBadRequest)
+		return
+	}
+
+	files, err := h.recordDownloader.ListRecordFiles(r.Context(), recordID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list voice files: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if len(files) == 0 {
+		h.downloadLegacyVoice(w, r, recordID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":    recordID,
+		"files": files,
+	})
+}
+
+// DownloadFile transfers single file of the voice record. Opus audio is converted
+// on the fly when another format is requested with the "format" query parameter.
+func (h *Handler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	recordID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid voice id", http.StatusBadRequest)
+		return
+	}
+
+	fileName := r.PathValue("file")
+	sourceFormat, isAudio := audio.FormatOf(fileName)
+	targetFormat := sourceFormat
+
+	if value := r.URL.Query().Get("format"); len(value) != 0 {
+		if targetFormat, err = audio.ParseFormat(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if targetFormat != sourceFormat && (!isAudio || sourceFormat != audio.FormatOpus) {
+			http.Error(w, "only opus files can be converted", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fileSrc, err := h.recordDownloader.DownloadRecordFile(r.Context(), recordID, fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "voice file not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to download voice: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer fileSrc.Close() // nolint: errcheck
+
+	if targetFormat == sourceFormat {
+		w.Header().Set("Content-Type", audio.ContentTypeOf(fileName))
+
+		if _, err = io.Copy(w, fileSrc); err != nil {
+			http.Error(w, fmt.Sprintf("failed to transfer voice: %s", err), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	convertedName := strings.TrimSuffix(path.Base(fileName), path.Ext(fileName)) + targetFormat.Extension()
+
+	w.Header().Set("Content-Type", targetFormat.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", convertedName))
+
+	if err = audio.Transcode(w, fileSrc, targetFormat); err != nil {
+		http.Error(w, fmt.Sprintf("failed to convert voice: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// downloadLegacyVoice transfers the whole voice record made before records have been split into files.
+func (h *Handler) downloadLegacyVoice(w http.ResponseWriter, r *http.Request, voiceID uuid.UUID) {
+	voiceSrc, err := h.recordDownloader.DownloadLegacyVoice(r.Context(), voiceID)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "voice not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to download voice: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer voiceSrc.Close() // nolint: errcheck
+
+	w.Header().Set("Content-Type", audio.FormatOpus.ContentType())
+
+	if _, err = io.Copy(w, voiceSrc); err != nil {
+		http.Error(w, fmt.Sprintf("failed to transfer voice: %s", err), http.StatusInternalServerError)
+	}
+}
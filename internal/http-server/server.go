@@ -4,13 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/kvizyx/voicelog/internal/bot"
 	"github.com/kvizyx/voicelog/internal/config"
+	"github.com/kvizyx/voicelog/internal/http-server/handlers/discord"
+	"github.com/kvizyx/voicelog/internal/http-server/handlers/records"
 	"github.com/kvizyx/voicelog/internal/storage/s3"
 	"github.com/kvizyx/voicelog/pkg/logger"
 )
@@ -19,13 +18,9 @@ type Server struct {
 	server *http.Server
 	router *gin.Engine
 
-	config          config.Config
-	logger          logger.Logger
-	voiceDownloader VoiceDownloader
-}
-
-type VoiceDownloader interface {
-	DownloadVoice(ctx context.Context, voiceID uuid.UUID) (io.ReadCloser, error)
+	config           config.Config
+	logger           logger.Logger
+	recordDownloader records.RecordDownloader
 }
 
 type Params struct {
@@ -51,45 +46,20 @@ func NewServer(p Params) Server {
 		server: server,
 		router: router,
 
-		config:          p.Config,
-		logger:          p.Logger,
-		voiceDownloader: p.Storage,
+		config:           p.Config,
+		logger:           p.Logger,
+		recordDownloader: p.Storage,
 	}
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	http.HandleFunc("GET /api/discord/invite-link", func(w http.ResponseWriter, r *http.Request) {
-		inviteLink := fmt.Sprintf(
-			"https://discord.com/oauth2/authorize?client_id=%s&permissions=%d&scope=bot",
-			s.config.Discord.ClientID, bot.Permissions,
-		)
-
-		http.Redirect(w, r, inviteLink, http.StatusFound)
-	})
-
-	http.HandleFunc("GET /api/voices/{id}", func(w http.ResponseWriter, r *http.Request) {
-		voiceID, err := uuid.Parse(r.PathValue("id"))
-		if err != nil {
-			http.Error(w, "invalid voice id", http.StatusBadRequest)
-			return
-		}
+	discordHandler := discord.NewHandler(s.config.Discord)
+	recordsHandler := records.NewHandler(s.recordDownloader)
 
-		voiceSrc, err := s.voiceDownloader.DownloadVoice(r.Context(), voiceID)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("failed to download voice: %s", err), http.StatusInternalServerError)
-			return
-		}
-		defer voiceSrc.Close() // nolint: errcheck
-
-		w.Header().Set("Content-Type", "audio/ogg")
-
-		if _, err = io.Copy(w, voiceSrc); err != nil {
-			http.Error(w, fmt.Sprintf("failed to transfer voice: %s", err), http.StatusInternalServerError)
-			return
-		}
+	http.HandleFunc("GET /api/discord/invite-link", discordHandler.InviteLink)
 
-		w.WriteHeader(http.StatusOK)
-	})
+	http.HandleFunc("GET /api/voices/{id}", recordsHandler.ListFiles)
+	http.HandleFunc("GET /api/voices/{id}/{file...}", recordsHandler.DownloadFile)
 
 	s.logger.Info("http server started")
 
@@ -4,13 +4,24 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kvizyx/voicelog/internal/audio"
 	"github.com/kvizyx/voicelog/internal/config"
 	"github.com/minio/minio-go/v7"
 )
 
+const (
+	// streamPartSize is a size of the parts record file streams are uploaded with. Stream
+	// holds streamUploadThreads parts in memory, so it is kept at the minimum allowed by s3.
+	streamPartSize      = 5 << 20 // 5 MiB
+	streamUploadThreads = 2
+)
+
 type Storage struct {
 	client *minio.Client
 
@@ -24,38 +35,148 @@ func NewStorage(client *minio.Client, config config.S3) Storage {
 	}
 }
 
-func (s *Storage) UploadVoice(ctx context.Context, ttl time.Duration, filePath string) (uuid.UUID, error) {
-	voiceID, err := uuid.NewRandom()
+// UploadRecordFile uploads file as a part of the voice record with given id. Content type
+// of the file is taken from the extension of its name.
+func (s *Storage) UploadRecordFile(
+	ctx context.Context,
+	recordID uuid.UUID,
+	ttl time.Duration,
+	name, filePath string,
+) error {
+	uploadOpts := minio.PutObjectOptions{
+		ContentType: audio.ContentTypeOf(name),
+		Expires:     time.Now().Add(ttl),
+	}
+
+	_, err := s.client.FPutObject(ctx, s.s3Config.Bucket, s.makeObjectName(recordID, name), filePath, uploadOpts)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("failed to generate id for voice record: %w", err)
+		return fmt.Errorf("failed to upload record file to s3: %w", err)
+	}
+
+	return nil
+}
+
+// UploadRecordStream starts upload of the voice record file, which content is written to the
+// returned writer. Upload is completed when the writer is closed.
+func (s *Storage) UploadRecordStream(
+	ctx context.Context,
+	recordID uuid.UUID,
+	ttl time.Duration,
+	name string,
+) io.WriteCloser {
+	reader, writer := io.Pipe()
+
+	upload := &streamUpload{
+		PipeWriter: writer,
+		done:       make(chan error, 1),
 	}
 
 	uploadOpts := minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
+		ContentType: audio.ContentTypeOf(name),
 		Expires:     time.Now().Add(ttl),
+		PartSize:    streamPartSize,
+		NumThreads:  streamUploadThreads,
+
+		// parts are uploaded while the next one is being written, so the writer is not blocked
+		ConcurrentStreamParts: true,
 	}
 
-	_, err = s.client.FPutObject(ctx, s.s3Config.Bucket, s.makeVoiceName(voiceID), filePath, uploadOpts)
+	go func() {
+		_, err := s.client.PutObject(ctx, s.s3Config.Bucket, s.makeObjectName(recordID, name), reader, -1, uploadOpts)
+
+		// writes fail from now on, if the upload is failed before the stream is finished
+		_ = reader.CloseWithError(err)
+
+		upload.done <- err
+	}()
+
+	return upload
+}
+
+// streamUpload is a writer of the record file stream.
+type streamUpload struct {
+	*io.PipeWriter
+	done chan error
+}
+
+// Close finishes the stream and waits for the upload to complete.
+func (u *streamUpload) Close() error {
+	_ = u.PipeWriter.Close()
+
+	if err := <-u.done; err != nil {
+		return fmt.Errorf("failed to upload record file stream to s3: %w", err)
+	}
+
+	return nil
+}
+
+// DownloadRecordFile downloads file with given name from the voice record. Error wraps
+// fs.ErrNotExist if there is no such file.
+func (s *Storage) DownloadRecordFile(ctx context.Context, recordID uuid.UUID, name string) (io.ReadCloser, error) {
+	recordFile, err := s.getObject(ctx, s.makeObjectName(recordID, name))
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("failed to upload voice to s3: %w", err)
+		return nil, fmt.Errorf("failed to download record file from s3: %w", err)
+	}
+
+	return recordFile, nil
+}
+
+// ListRecordFiles returns names of all files stored within the voice record.
+func (s *Storage) ListRecordFiles(ctx context.Context, recordID uuid.UUID) ([]string, error) {
+	prefix := s.makeObjectName(recordID, "")
+
+	objects := s.client.ListObjects(ctx, s.s3Config.Bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	files := make([]string, 0)
+
+	for object := range objects {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list record files in s3: %w", object.Err)
+		}
+
+		files = append(files, strings.TrimPrefix(object.Key, prefix))
 	}
 
-	return voiceID, nil
+	return files, nil
 }
 
-func (s *Storage) DownloadVoice(ctx context.Context, voiceID uuid.UUID) (io.ReadCloser, error) {
-	voiceRecord, err := s.client.GetObject(
-		ctx, s.s3Config.Bucket,
-		s.makeVoiceName(voiceID),
-		minio.GetObjectOptions{},
-	)
+// DownloadLegacyVoice downloads voice record stored by the earlier versions as a single
+// "<id>.ogg" object, before records have been split into files. Error wraps fs.ErrNotExist
+// if there is no such object.
+func (s *Storage) DownloadLegacyVoice(ctx context.Context, voiceID uuid.UUID) (io.ReadCloser, error) {
+	voiceRecord, err := s.getObject(ctx, voiceID.String()+".ogg")
 	if err != nil {
-		return nil, fmt.Errorf("failed to download voice from s3: %w", err)
+		return nil, fmt.Errorf("failed to download legacy voice record from s3: %w", err)
 	}
 
 	return voiceRecord, nil
 }
 
-func (s *Storage) makeVoiceName(id uuid.UUID) string {
-	return fmt.Sprintf("%s.ogg", id.String())
+// getObject starts download of the object. Object is downloaded lazily, so the first request
+// is made here to find out its absence before anything is read. Error wraps fs.ErrNotExist
+// if there is no such object.
+func (s *Storage) getObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.s3Config.Bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = object.Stat(); err != nil {
+		_ = object.Close()
+
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("object %q not found: %w", name, fs.ErrNotExist)
+		}
+
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func (s *Storage) makeObjectName(recordID uuid.UUID, name string) string {
+	return fmt.Sprintf("%s/%s", recordID.String(), name)
 }
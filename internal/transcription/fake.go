@@ -0,0 +1,28 @@
+package transcription
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Fake is a transcriber which does not recognize anything, for development and tests
+// without transcription engine installed.
+type Fake struct {
+	// Segments are returned for every audio. If empty, the whole audio is a single
+	// segment with a placeholder text.
+	Segments []Segment
+}
+
+func (f *Fake) Transcribe(_ context.Context, in io.Reader) ([]Segment, error) {
+	if len(f.Segments) != 0 {
+		return f.Segments, nil
+	}
+
+	// audio is not decoded, so its duration is not known
+	if _, err := io.Copy(io.Discard, in); err != nil {
+		return nil, err
+	}
+
+	return []Segment{{Start: 0, End: time.Second, Text: "(transcription is not available)"}}, nil
+}
@@ -0,0 +1,43 @@
+// Package transcription turns recorded speech into timestamped text.
+package transcription
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kvizyx/voicelog/internal/config"
+)
+
+// Transcriber transcribes speech of a single speaker.
+type Transcriber interface {
+	// Transcribe transcribes Ogg Opus audio. Segments are timed from the beginning of the audio.
+	Transcribe(ctx context.Context, in io.Reader) ([]Segment, error)
+}
+
+// Segment is a piece of transcribed speech.
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// New creates transcriber of the engine selected by the config. It returns nil if
+// transcription is disabled.
+func New(config config.Transcription) (Transcriber, error) {
+	switch config.Engine {
+	case "":
+		return nil, nil
+	case "whisper":
+		return NewWhisper(WhisperParams{
+			BinaryPath: config.WhisperBinary,
+			ModelPath:  config.WhisperModel,
+			Language:   config.Language,
+		})
+	case "fake":
+		return &Fake{}, nil
+	default:
+		return nil, fmt.Errorf("unknown transcription engine %q", config.Engine)
+	}
+}
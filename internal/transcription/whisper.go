@@ -0,0 +1,242 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kvizyx/voicelog/internal/audio"
+	"github.com/kvizyx/voicelog/pkg/wav"
+)
+
+const (
+	defaultWhisperBinary = "whisper-cli"
+
+	// whisperSampleRate is a sample rate of mono audio whisper models are trained on.
+	whisperSampleRate = 16000
+)
+
+// Whisper transcribes speech with locally installed whisper.cpp command line tool.
+type Whisper struct {
+	binaryPath string
+	modelPath  string
+	language   string
+}
+
+type WhisperParams struct {
+	// BinaryPath is a path to the whisper.cpp binary, which is looked up in PATH
+	// as "whisper-cli" if empty.
+	BinaryPath string
+	// ModelPath is a path to the ggml model file.
+	ModelPath string
+	// Language is a spoken language code, it is detected automatically if empty.
+	Language string
+}
+
+func NewWhisper(params WhisperParams) (*Whisper, error) {
+	if params.ModelPath == "" {
+		return nil, errors.New("whisper model path is not set")
+	}
+
+	if params.BinaryPath == "" {
+		params.BinaryPath = defaultWhisperBinary
+	}
+	if params.Language == "" {
+		params.Language = "auto"
+	}
+
+	binaryPath, err := exec.LookPath(params.BinaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find whisper binary: %w", err)
+	}
+
+	return &Whisper{
+		binaryPath: binaryPath,
+		modelPath:  params.ModelPath,
+		language:   params.Language,
+	}, nil
+}
+
+// whisperOutput is a part of the JSON output of whisper.cpp which is used.
+type whisperOutput struct {
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"` // in milliseconds
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text string `json:"text"`
+	} `json:"transcription"`
+}
+
+func (w *Whisper) Transcribe(ctx context.Context, in io.Reader) ([]Segment, error) {
+	dir, err := os.MkdirTemp("", "voicelog-whisper-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	inputPath := filepath.Join(dir, "speech.wav")
+	outputPrefix := filepath.Join(dir, "transcript")
+
+	if err = writeSpeechWAV(inputPath, in); err != nil {
+		return nil, fmt.Errorf("failed to prepare audio: %w", err)
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(
+		ctx, w.binaryPath,
+		"--model", w.modelPath,
+		"--language", w.language,
+		"--file", inputPath,
+		"--output-json",
+		"--output-file", outputPrefix,
+		"--no-prints",
+	)
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	data, err := os.ReadFile(outputPrefix + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read whisper output: %w", err)
+	}
+
+	var output whisperOutput
+
+	if err = json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper output: %w", err)
+	}
+
+	segments := make([]Segment, 0, len(output.Transcription))
+
+	for _, item := range output.Transcription {
+		text := strings.TrimSpace(item.Text)
+		if text == "" {
+			continue
+		}
+
+		segments = append(segments, Segment{
+			Start: time.Duration(item.Offsets.From) * time.Millisecond,
+			End:   time.Duration(item.Offsets.To) * time.Millisecond,
+			Text:  text,
+		})
+	}
+
+	return segments, nil
+}
+
+// writeSpeechWAV decodes Ogg Opus audio into 16kHz mono WAVE file whisper.cpp expects.
+func writeSpeechWAV(path string, in io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close() // nolint: errcheck
+
+	writer := wav.NewWriter(file, whisperSampleRate, 1)
+	resampler := newDownsampler()
+
+	err = audio.Decode(in, func(pcm []int16) error {
+		return writer.Write(resampler.process(pcm))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+const (
+	// decimation is the ratio of decoded and whisper sample rates.
+	decimation = audio.SampleRate / whisperSampleRate
+
+	downsamplerTaps = 31
+)
+
+// downsamplerFilter is a windowed sinc low pass filter removing frequencies above
+// the Nyquist frequency of the whisper sample rate before decimation.
+var downsamplerFilter = func() [downsamplerTaps]float64 {
+	var taps [downsamplerTaps]float64
+
+	cutoff := 0.9 * whisperSampleRate / 2 / audio.SampleRate // relative to the sample rate
+
+	var sum float64
+	for i := range taps {
+		n := float64(i) - (downsamplerTaps-1)/2.0
+
+		value := 2 * cutoff
+		if n != 0 {
+			value = math.Sin(2*math.Pi*cutoff*n) / (math.Pi * n)
+		}
+
+		// Hamming window
+		value *= 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/(downsamplerTaps-1))
+
+		taps[i] = value
+		sum += value
+	}
+
+	for i := range taps {
+		taps[i] /= sum
+	}
+
+	return taps
+}()
+
+// downsampler converts interleaved stereo pcm of the decoded audio into mono pcm of
+// the whisper sample rate.
+type downsampler struct {
+	history [downsamplerTaps]float64 // last mono samples, the most recent first
+	phase   int                      // number of samples since the last output one
+	out     []int16
+}
+
+func newDownsampler() *downsampler {
+	return &downsampler{}
+}
+
+func (d *downsampler) process(pcm []int16) []int16 {
+	d.out = d.out[:0]
+
+	for i := 0; i+audio.Channels <= len(pcm); i += audio.Channels {
+		var mono float64
+		for c := 0; c < audio.Channels; c++ {
+			mono += float64(pcm[i+c])
+		}
+
+		copy(d.history[1:], d.history[:downsamplerTaps-1])
+		d.history[0] = mono / audio.Channels
+
+		d.phase++
+		if d.phase < decimation {
+			continue
+		}
+
+		d.phase = 0
+
+		var value float64
+		for tap, coefficient := range downsamplerFilter {
+			value += coefficient * d.history[tap]
+		}
+
+		d.out = append(d.out, int16(max(math.MinInt16, min(math.MaxInt16, value))))
+	}
+
+	return d.out
+}
@@ -0,0 +1,214 @@
+// Package cron parses standard five-field cron expressions and finds times they match.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchYears is how far ahead the next matching time is searched for, as an expression
+// like "0 0 30 2 *" never matches.
+const maxSearchYears = 5
+
+var ErrNeverMatches = errors.New("cron expression never matches")
+
+// Schedule is a parsed cron expression: minute, hour, day of month, month and day of week.
+// Every field is a set of allowed values, each bit is a value.
+type Schedule struct {
+	minutes, hours, days, months, weekdays uint64
+
+	// day matches if any of the day fields matches, when both of them are restricted,
+	// that is they do not start with "*" (so "*/2" is not a restriction)
+	anyDay bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7}, // both 0 and 7 are Sunday
+}
+
+// Parse parses expression of five fields separated by spaces. Field is a comma separated list
+// of values, ranges ("1-5") and "*", each of which may have a step ("*/15", "0-30/10").
+func Parse(expression string) (Schedule, error) {
+	values := strings.Fields(expression)
+	if len(values) != len(fields) {
+		return Schedule{}, fmt.Errorf("expected %d fields in cron expression, got %d", len(fields), len(values))
+	}
+
+	sets := make([]uint64, len(fields))
+
+	for i, value := range values {
+		set, err := parseField(value, fields[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid %s: %w", fields[i].name, err)
+		}
+
+		sets[i] = set
+	}
+
+	// Sunday is matched by 0 only
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+
+	return Schedule{
+		minutes:  sets[0],
+		hours:    sets[1],
+		days:     sets[2],
+		months:   sets[3],
+		weekdays: sets[4],
+		anyDay:   !strings.HasPrefix(values[2], "*") && !strings.HasPrefix(values[4], "*"),
+	}, nil
+}
+
+func parseField(value string, f field) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(value, ",") {
+		rangeValue, stepValue, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepValue)
+			}
+		}
+
+		from, to := f.min, f.max
+
+		if rangeValue != "*" {
+			fromValue, toValue, isRange := strings.Cut(rangeValue, "-")
+
+			var err error
+			if from, err = parseValue(fromValue, f); err != nil {
+				return 0, err
+			}
+
+			to = from
+			if isRange {
+				if to, err = parseValue(toValue, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				to = f.max
+			}
+
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q", rangeValue)
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %q is out of range %d-%d", value, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+// Next returns the first time after given one which matches the schedule, in the location of
+// the given time. Each wall clock time is matched once: times skipped when clocks are turned
+// forward never match, and times repeated when clocks are turned back match only the first time.
+// ErrNeverMatches is returned if there is no such time in the next few years.
+func (s Schedule) Next(after time.Time) (time.Time, error) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	end := after.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(end) {
+		if s.months&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+
+			// midnight skipped by the clocks turned forward is moved back to the previous day
+			if t.Day() != 1 {
+				t = nextDay(t)
+			}
+
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = nextDay(t)
+			continue
+		}
+
+		if s.hours&(1<<t.Hour()) == 0 {
+			t = nextHour(t)
+			continue
+		}
+
+		if s.minutes&(1<<t.Minute()) == 0 || repeatedWallClock(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t, nil
+	}
+
+	return time.Time{}, ErrNeverMatches
+}
+
+// nextHour returns the start of the next hour. Unlike time.Date, it moves forward when the
+// wall clock of the next hour is skipped by the clocks turned forward.
+func nextHour(t time.Time) time.Time {
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// nextDay returns the first hour of the next day.
+func nextDay(t time.Time) time.Time {
+	day := t.Day()
+
+	for t.Day() == day {
+		t = nextHour(t)
+	}
+
+	return t
+}
+
+// repeatedWallClock reports whether the wall clock of the time has already been shown before
+// the clocks were turned back.
+func repeatedWallClock(t time.Time) bool {
+	_, offset := t.Zone()
+	_, dayBeforeOffset := t.Add(-24 * time.Hour).Zone()
+
+	if dayBeforeOffset <= offset {
+		return false
+	}
+
+	// the same wall clock with the previous offset
+	earlier := t.Add(-time.Duration(dayBeforeOffset-offset) * time.Second)
+	_, earlierOffset := earlier.Zone()
+
+	return earlierOffset == dayBeforeOffset
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<t.Day()) != 0
+	weekday := s.weekdays&(1<<int(t.Weekday())) != 0
+
+	if s.anyDay {
+		return day || weekday
+	}
+
+	return day && weekday
+}
@@ -0,0 +1,200 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata" // the same time zones wherever tests run
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       Schedule
+		wantErr    bool
+	}{
+		{
+			expression: "* * * * *",
+			want:       Schedule{minutes: 1<<60 - 1, hours: 1<<24 - 1, days: 1<<32 - 2, months: 1<<13 - 2, weekdays: 1<<7 - 1},
+		},
+		{
+			expression: "0,30 9-17/4 1 */3 1-5",
+			want:       Schedule{minutes: 1 | 1<<30, hours: 1<<9 | 1<<13 | 1<<17, days: 1 << 1, months: 1<<1 | 1<<4 | 1<<7 | 1<<10, weekdays: 0b111110, anyDay: true},
+		},
+		{
+			expression: "5/20 0 */2 * 7",
+			want:       Schedule{minutes: 1<<5 | 1<<25 | 1<<45, hours: 1, days: 0xAAAAAAAA, months: 1<<13 - 2, weekdays: 1},
+		},
+		{expression: "* * * *", wantErr: true},
+		{expression: "60 * * * *", wantErr: true},
+		{expression: "* 24 * * *", wantErr: true},
+		{expression: "* * 0 * *", wantErr: true},
+		{expression: "* * * 13 *", wantErr: true},
+		{expression: "* * * * 8", wantErr: true},
+		{expression: "*/0 * * * *", wantErr: true},
+		{expression: "10-5 * * * *", wantErr: true},
+		{expression: "a * * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.expression)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) succeeded, want error", tt.expression)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.expression, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		after      time.Time
+		want       time.Time
+	}{
+		{
+			name:       "every 15 minutes",
+			expression: "*/15 * * * *",
+			after:      utc(2026, 10, 18, 12, 7),
+			want:       utc(2026, 10, 18, 12, 15),
+		},
+		{
+			name:       "matching time is excluded",
+			expression: "*/15 * * * *",
+			after:      utc(2026, 10, 18, 12, 15).Add(30 * time.Second),
+			want:       utc(2026, 10, 18, 12, 30),
+		},
+		{
+			name:       "day of month stepped from any day is not restricted",
+			expression: "0 0 */2 * 1",
+			after:      utc(2026, 11, 3, 0, 0),
+			want:       utc(2026, 11, 9, 0, 0),
+		},
+		{
+			name:       "day of month or day of week when both restricted",
+			expression: "0 0 13 * 5",
+			after:      utc(2026, 10, 18, 0, 0),
+			want:       utc(2026, 10, 23, 0, 0),
+		},
+		{
+			name:       "Sunday as 7",
+			expression: "0 10 * * 7",
+			after:      utc(2026, 10, 19, 0, 0),
+			want:       utc(2026, 10, 25, 10, 0),
+		},
+		{
+			name:       "next month",
+			expression: "0 9 1 * *",
+			after:      utc(2026, 10, 31, 10, 0),
+			want:       utc(2026, 11, 1, 9, 0),
+		},
+		{
+			name:       "month without the day",
+			expression: "0 0 31 * *",
+			after:      utc(2026, 4, 1, 0, 0),
+			want:       utc(2026, 5, 31, 0, 0),
+		},
+		{
+			name:       "next year",
+			expression: "30 23 31 12 *",
+			after:      utc(2026, 12, 31, 23, 30),
+			want:       utc(2027, 12, 31, 23, 30),
+		},
+		{
+			name:       "leap day",
+			expression: "0 0 29 2 *",
+			after:      utc(2026, 3, 1, 0, 0),
+			want:       utc(2028, 2, 29, 0, 0),
+		},
+		{
+			name:       "hour after clocks are turned forward",
+			expression: "0 3 * * *",
+			after:      utc(2027, 3, 14, 5, 0).In(newYork), // 0:00 EST
+			want:       utc(2027, 3, 14, 7, 0),             // 3:00 EDT
+		},
+		{
+			name:       "time skipped when clocks are turned forward",
+			expression: "30 2 * * *",
+			after:      utc(2027, 3, 13, 8, 0).In(newYork), // 3:00 EST the day before
+			want:       utc(2027, 3, 15, 6, 30),            // 2:30 EDT the day after
+		},
+		{
+			name:       "first of repeated times when clocks are turned back",
+			expression: "30 1 * * *",
+			after:      utc(2026, 11, 1, 4, 0).In(newYork), // 0:00 EDT
+			want:       utc(2026, 11, 1, 5, 30),            // 1:30 EDT
+		},
+		{
+			name:       "repeated time when clocks are turned back",
+			expression: "30 1 * * *",
+			after:      utc(2026, 11, 1, 5, 30).In(newYork), // 1:30 EDT
+			want:       utc(2026, 11, 2, 6, 30),             // 1:30 EST the day after
+		},
+		{
+			name:       "search starts in the repeated hour",
+			expression: "30 1 * * *",
+			after:      utc(2026, 11, 1, 6, 15).In(newYork), // 1:15 EST
+			want:       utc(2026, 11, 2, 6, 30),             // 1:30 EST the day after
+		},
+		{
+			name:       "hourly when clocks are turned back",
+			expression: "0 * * * *",
+			after:      utc(2026, 11, 1, 5, 0).In(newYork), // 1:00 EDT
+			want:       utc(2026, 11, 1, 7, 0),             // 2:00 EST
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", tt.expression, err)
+			}
+
+			got, err := schedule.Next(tt.after)
+			if err != nil {
+				t.Fatalf("Next(%v) failed: %v", tt.after, err)
+			}
+
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want.In(tt.after.Location()))
+			}
+
+			if got.Location() != tt.after.Location() {
+				t.Errorf("Next(%v) is in %v", tt.after, got.Location())
+			}
+		})
+	}
+}
+
+func TestNextNeverMatches(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("failed to parse expression: %v", err)
+	}
+
+	if _, err = schedule.Next(time.Now()); !errors.Is(err, ErrNeverMatches) {
+		t.Errorf("got %v, want %v", err, ErrNeverMatches)
+	}
+}
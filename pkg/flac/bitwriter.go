@@ -0,0 +1,50 @@
+package flac
+
+// bitWriter writes big-endian bit fields into the byte buffer.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64 // pending bits, aligned to the right
+	nbits uint   // number of pending bits
+}
+
+// writeBits writes n (up to 32) lowest bits of the value.
+func (w *bitWriter) writeBits(value uint64, n uint) {
+	if n == 0 {
+		return
+	}
+
+	w.acc = (w.acc << n) | (value & (1<<n - 1))
+	w.nbits += n
+
+	for w.nbits >= 8 {
+		w.nbits -= 8
+		w.buf = append(w.buf, byte(w.acc>>w.nbits))
+	}
+}
+
+// writeSigned writes signed value in n bits two's complement form.
+func (w *bitWriter) writeSigned(value int64, n uint) {
+	w.writeBits(uint64(value), n)
+}
+
+// writeUnary writes value zero bits terminated by the single one bit.
+func (w *bitWriter) writeUnary(value uint64) {
+	for ; value >= 32; value -= 32 {
+		w.writeBits(0, 32)
+	}
+
+	w.writeBits(1, uint(value)+1)
+}
+
+// align pads buffer with zero bits up to the byte boundary.
+func (w *bitWriter) align() {
+	if w.nbits > 0 {
+		w.writeBits(0, 8-w.nbits)
+	}
+}
+
+func (w *bitWriter) reset() {
+	w.buf = w.buf[:0]
+	w.acc = 0
+	w.nbits = 0
+}
@@ -0,0 +1,37 @@
+package flac
+
+// crc8 computes CRC-8 of the frame header (polynomial x^8 + x^2 + x + 1).
+func crc8(data []byte) uint8 {
+	var crc uint8
+
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = (crc << 1) ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// crc16 computes CRC-16 of the frame (polynomial x^16 + x^15 + x^2 + 1).
+func crc16(data []byte) uint16 {
+	var crc uint16
+
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
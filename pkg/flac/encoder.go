@@ -0,0 +1,523 @@
+// Package flac implements encoder of 16-bit pcm into FLAC stream. Only fixed linear
+// predictors and stereo decorrelation are used, which is enough for speech recordings.
+package flac
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+const (
+	blockSize     = 4096
+	bitsPerSample = 16
+
+	maxFixedOrder     = 4
+	maxPartitionOrder = 8
+	maxRiceParameter  = 14 // 4-bit rice parameters, 15 is an escape code
+
+	streamInfoSize = 34
+)
+
+// channel assignments of the frame header
+const (
+	channelsIndependent = iota
+	channelsLeftSide    = 0b1000
+	channelsSideRight   = 0b1001
+	channelsMidSide     = 0b1010
+)
+
+// Encoder encodes interleaved 16-bit pcm into FLAC stream. STREAMINFO block is
+// updated with total samples count and MD5 signature on Close if the output is seekable.
+type Encoder struct {
+	out io.Writer
+
+	sampleRate int
+	channels   int
+
+	block       [][]int32 // samples of the block being filled by channel
+	blockLength int
+
+	frameNumber    uint64
+	totalSamples   uint64
+	minFrameSize   int
+	maxFrameSize   int
+	signature      hash.Hash
+	headerWritten  bool
+	frame          bitWriter
+	residualBuffer []int64
+}
+
+func NewEncoder(out io.Writer, sampleRate, channels int) (*Encoder, error) {
+	if channels < 1 || channels > 2 {
+		return nil, fmt.Errorf("unsupported number of channels: %d", channels)
+	}
+
+	block := make([][]int32, channels)
+	for i := range block {
+		block[i] = make([]int32, blockSize)
+	}
+
+	return &Encoder{
+		out:            out,
+		sampleRate:     sampleRate,
+		channels:       channels,
+		block:          block,
+		minFrameSize:   math.MaxInt,
+		signature:      md5.New(),
+		residualBuffer: make([]int64, blockSize),
+	}, nil
+}
+
+// Write encodes interleaved pcm samples.
+func (e *Encoder) Write(pcm []int16) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	raw := make([]byte, 0, len(pcm)*2)
+	for _, sample := range pcm {
+		raw = binary.LittleEndian.AppendUint16(raw, uint16(sample))
+	}
+
+	e.signature.Write(raw)
+
+	for i := 0; i+e.channels <= len(pcm); i += e.channels {
+		for c := 0; c < e.channels; c++ {
+			e.block[c][e.blockLength] = int32(pcm[i+c])
+		}
+
+		e.blockLength++
+
+		if e.blockLength == blockSize {
+			if err := e.writeFrame(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close encodes the rest of samples and updates STREAMINFO if the output is seekable.
+// It does not close the output.
+func (e *Encoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	if e.blockLength > 0 {
+		if err := e.writeFrame(); err != nil {
+			return err
+		}
+	}
+
+	seeker, ok := e.out.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+
+	// stream info follows "fLaC" marker and header of the metadata block
+	if _, err := seeker.Seek(8, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to stream info: %w", err)
+	}
+
+	if _, err := seeker.Write(e.streamInfo(true)); err != nil {
+		return fmt.Errorf("failed to update stream info: %w", err)
+	}
+
+	_, err := seeker.Seek(0, io.SeekEnd)
+
+	return err
+}
+
+func (e *Encoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+
+	e.headerWritten = true
+
+	header := []byte("fLaC")
+	header = append(header, 0x80) // last metadata block, STREAMINFO
+	header = append(header, 0, 0, streamInfoSize)
+	header = append(header, e.streamInfo(false)...)
+
+	_, err := e.out.Write(header)
+
+	return err
+}
+
+// streamInfo returns STREAMINFO metadata block, statistics are filled only when the stream is complete.
+func (e *Encoder) streamInfo(complete bool) []byte {
+	var w bitWriter
+
+	w.writeBits(blockSize, 16) // min block size
+	w.writeBits(blockSize, 16) // max block size
+
+	if complete && e.frameNumber > 0 {
+		w.writeBits(uint64(e.minFrameSize), 24)
+		w.writeBits(uint64(e.maxFrameSize), 24)
+	} else {
+		w.writeBits(0, 24)
+		w.writeBits(0, 24)
+	}
+
+	w.writeBits(uint64(e.sampleRate), 20)
+	w.writeBits(uint64(e.channels-1), 3)
+	w.writeBits(bitsPerSample-1, 5)
+
+	if complete {
+		w.writeBits(e.totalSamples>>32, 4)
+		w.writeBits(e.totalSamples, 32)
+		w.buf = append(w.buf, e.signature.Sum(nil)...)
+	} else {
+		w.writeBits(0, 36)
+		w.buf = append(w.buf, make([]byte, md5.Size)...)
+	}
+
+	return w.buf
+}
+
+func (e *Encoder) writeFrame() error {
+	length := e.blockLength
+	channels := make([][]int32, e.channels)
+
+	for c := range channels {
+		channels[c] = e.block[c][:length]
+	}
+
+	assignment := channelsIndependent + e.channels - 1
+	if e.channels == 2 {
+		assignment, channels = decorrelate(channels[0], channels[1])
+	}
+
+	w := &e.frame
+	w.reset()
+
+	e.writeFrameHeader(w, assignment, length)
+
+	for c, samples := range channels {
+		sampleBits := uint(bitsPerSample)
+
+		// side channel needs an extra bit
+		isSide := (assignment == channelsLeftSide && c == 1) ||
+			(assignment == channelsSideRight && c == 0) ||
+			(assignment == channelsMidSide && c == 1)
+		if isSide {
+			sampleBits++
+		}
+
+		e.writeSubframe(w, samples, sampleBits)
+	}
+
+	w.align()
+	w.writeBits(uint64(crc16(w.buf)), 16)
+
+	if _, err := e.out.Write(w.buf); err != nil {
+		return err
+	}
+
+	e.minFrameSize = min(e.minFrameSize, len(w.buf))
+	e.maxFrameSize = max(e.maxFrameSize, len(w.buf))
+	e.totalSamples += uint64(length)
+	e.frameNumber++
+	e.blockLength = 0
+
+	return nil
+}
+
+func (e *Encoder) writeFrameHeader(w *bitWriter, assignment, length int) {
+	w.writeBits(0b11111111111110, 14) // sync code
+	w.writeBits(0, 1)                 // reserved
+	w.writeBits(0, 1)                 // fixed block size
+
+	if length == blockSize {
+		w.writeBits(0b1100, 4) // 4096 samples
+	} else {
+		w.writeBits(0b0111, 4) // 16-bit block size at the end of the header
+	}
+
+	w.writeBits(sampleRateCode(e.sampleRate), 4)
+	w.writeBits(uint64(assignment), 4)
+	w.writeBits(0b100, 3) // 16 bits per sample
+	w.writeBits(0, 1)     // reserved
+
+	writeUTF8(w, e.frameNumber)
+
+	if length != blockSize {
+		w.writeBits(uint64(length-1), 16)
+	}
+
+	switch sampleRateCode(e.sampleRate) {
+	case 0b1100:
+		w.writeBits(uint64(e.sampleRate/1000), 8)
+	case 0b1101:
+		w.writeBits(uint64(e.sampleRate), 16)
+	case 0b1110:
+		w.writeBits(uint64(e.sampleRate/10), 16)
+	}
+
+	w.writeBits(uint64(crc8(w.buf)), 8)
+}
+
+// writeSubframe writes constant subframe if all samples are equal or fixed subframe of
+// the order which gives the smallest residual.
+func (e *Encoder) writeSubframe(w *bitWriter, samples []int32, sampleBits uint) {
+	constant := true
+	for _, sample := range samples {
+		constant = constant && sample == samples[0]
+	}
+
+	if constant {
+		w.writeBits(0, 1)        // padding
+		w.writeBits(0b000000, 6) // CONSTANT
+		w.writeBits(0, 1)        // no wasted bits
+		w.writeSigned(int64(samples[0]), sampleBits)
+
+		return
+	}
+
+	order := bestFixedOrder(samples)
+	residual := fixedResidual(samples, order, e.residualBuffer)
+
+	w.writeBits(0, 1)                      // padding
+	w.writeBits(0b001000|uint64(order), 6) // FIXED
+	w.writeBits(0, 1)                      // no wasted bits
+
+	for _, sample := range samples[:order] {
+		w.writeSigned(int64(sample), sampleBits)
+	}
+
+	writeResidual(w, residual, len(samples), order)
+}
+
+// decorrelate chooses stereo channel assignment which needs the smallest residual.
+func decorrelate(left, right []int32) (int, [][]int32) {
+	side := make([]int32, len(left))
+	mid := make([]int32, len(left))
+
+	for i := range left {
+		side[i] = left[i] - right[i]
+		mid[i] = (left[i] + right[i]) >> 1
+	}
+
+	cost := func(samples []int32) uint64 {
+		return fixedCost(samples, bestFixedOrder(samples))
+	}
+
+	leftCost, rightCost, sideCost, midCost := cost(left), cost(right), cost(side), cost(mid)
+
+	options := []struct {
+		assignment int
+		channels   [][]int32
+		cost       uint64
+	}{
+		{channelsIndependent + 1, [][]int32{left, right}, leftCost + rightCost},
+		{channelsLeftSide, [][]int32{left, side}, leftCost + sideCost},
+		{channelsSideRight, [][]int32{side, right}, sideCost + rightCost},
+		{channelsMidSide, [][]int32{mid, side}, midCost + sideCost},
+	}
+
+	best := options[0]
+	for _, option := range options[1:] {
+		if option.cost < best.cost {
+			best = option
+		}
+	}
+
+	return best.assignment, best.channels
+}
+
+// bestFixedOrder returns fixed predictor order with the smallest sum of absolute residuals.
+func bestFixedOrder(samples []int32) int {
+	bestOrder, bestCost := 0, uint64(math.MaxUint64)
+
+	for order := 0; order <= maxFixedOrder && order < len(samples); order++ {
+		if cost := fixedCost(samples, order); cost < bestCost {
+			bestOrder, bestCost = order, cost
+		}
+	}
+
+	return bestOrder
+}
+
+func fixedCost(samples []int32, order int) uint64 {
+	var cost uint64
+
+	for i := order; i < len(samples); i++ {
+		residual := fixedPrediction(samples, i, order)
+		if residual < 0 {
+			residual = -residual
+		}
+
+		cost += uint64(residual)
+	}
+
+	return cost
+}
+
+func fixedResidual(samples []int32, order int, buf []int64) []int64 {
+	residual := buf[:0]
+
+	for i := order; i < len(samples); i++ {
+		residual = append(residual, fixedPrediction(samples, i, order))
+	}
+
+	return residual
+}
+
+// fixedPrediction returns residual of the i-th sample predicted by the fixed polynomial predictor.
+func fixedPrediction(samples []int32, i, order int) int64 {
+	s := func(j int) int64 { return int64(samples[i-j]) }
+
+	switch order {
+	case 0:
+		return s(0)
+	case 1:
+		return s(0) - s(1)
+	case 2:
+		return s(0) - 2*s(1) + s(2)
+	case 3:
+		return s(0) - 3*s(1) + 3*s(2) - s(3)
+	default:
+		return s(0) - 4*s(1) + 6*s(2) - 4*s(3) + s(4)
+	}
+}
+
+// writeResidual writes residual coded with partitioned rice coding, choosing partition
+// order and rice parameters which give the smallest size.
+func writeResidual(w *bitWriter, residual []int64, blockLength, predictorOrder int) {
+	folded := make([]uint64, len(residual))
+	for i, value := range residual {
+		folded[i] = uint64((value << 1) ^ (value >> 63))
+	}
+
+	bestOrder, bestBits := 0, uint64(math.MaxUint64)
+	var bestParameters []uint
+
+	for order := 0; order <= maxPartitionOrder; order++ {
+		partitions := 1 << order
+		if blockLength%partitions != 0 || blockLength/partitions <= predictorOrder {
+			break
+		}
+
+		bits, parameters := partitionsCost(folded, blockLength, predictorOrder, order)
+		if bits < bestBits {
+			bestOrder, bestBits, bestParameters = order, bits, parameters
+		}
+	}
+
+	w.writeBits(0b00, 2) // rice coding with 4-bit parameters
+	w.writeBits(uint64(bestOrder), 4)
+
+	offset := 0
+	for p, parameter := range bestParameters {
+		size := blockLength >> bestOrder
+		if p == 0 {
+			size -= predictorOrder
+		}
+
+		w.writeBits(uint64(parameter), 4)
+
+		for _, value := range folded[offset : offset+size] {
+			w.writeUnary(value >> parameter)
+			w.writeBits(value, parameter)
+		}
+
+		offset += size
+	}
+}
+
+func partitionsCost(folded []uint64, blockLength, predictorOrder, order int) (uint64, []uint) {
+	var (
+		total      uint64
+		parameters = make([]uint, 1<<order)
+		offset     int
+	)
+
+	for p := range parameters {
+		size := blockLength >> order
+		if p == 0 {
+			size -= predictorOrder
+		}
+
+		bits, parameter := riceCost(folded[offset : offset+size])
+		total += bits + 4
+		parameters[p] = parameter
+		offset += size
+	}
+
+	return total, parameters
+}
+
+// riceCost returns the smallest size of values coded with rice code and the parameter giving it.
+func riceCost(values []uint64) (uint64, uint) {
+	bestBits, bestParameter := uint64(math.MaxUint64), uint(0)
+
+	for parameter := uint(0); parameter <= maxRiceParameter; parameter++ {
+		bits := uint64(len(values)) * uint64(parameter+1)
+		for _, value := range values {
+			bits += value >> parameter
+		}
+
+		if bits < bestBits {
+			bestBits, bestParameter = bits, parameter
+		}
+	}
+
+	return bestBits, bestParameter
+}
+
+func sampleRateCode(sampleRate int) uint64 {
+	switch sampleRate {
+	case 8000:
+		return 0b0100
+	case 16000:
+		return 0b0101
+	case 22050:
+		return 0b0110
+	case 24000:
+		return 0b0111
+	case 32000:
+		return 0b1000
+	case 44100:
+		return 0b1001
+	case 48000:
+		return 0b1010
+	case 96000:
+		return 0b1011
+	}
+
+	switch {
+	case sampleRate%1000 == 0 && sampleRate/1000 <= 255:
+		return 0b1100 // 8-bit sample rate in kHz at the end of the header
+	case sampleRate <= math.MaxUint16:
+		return 0b1101 // 16-bit sample rate in Hz at the end of the header
+	default:
+		return 0b1110 // 16-bit sample rate in tens of Hz at the end of the header
+	}
+}
+
+// writeUTF8 writes value in the "UTF-8" coding used by FLAC for frame numbers.
+func writeUTF8(w *bitWriter, value uint64) {
+	if value < 0x80 {
+		w.writeBits(value, 8)
+		return
+	}
+
+	// number of continuation bytes
+	n := uint(1)
+	for value >= 1<<(5*n+6) {
+		n++
+	}
+
+	w.writeBits((0xFF<<(7-n))&0xFF|value>>(6*n), 8)
+
+	for i := n; i > 0; i-- {
+		w.writeBits(0x80|(value>>(6*(i-1)))&0x3F, 8)
+	}
+}
@@ -0,0 +1,219 @@
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type streamInfo struct {
+	minBlockSize  int
+	maxBlockSize  int
+	minFrameSize  int
+	maxFrameSize  int
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	totalSamples  uint64
+	signature     []byte
+}
+
+func parseStreamInfo(t *testing.T, data []byte) streamInfo {
+	t.Helper()
+
+	if len(data) < 8+streamInfoSize || string(data[:4]) != "fLaC" {
+		t.Fatalf("stream does not start with STREAMINFO")
+	}
+
+	block := data[8 : 8+streamInfoSize]
+	packed := binary.BigEndian.Uint64(block[10:18])
+
+	return streamInfo{
+		minBlockSize:  int(binary.BigEndian.Uint16(block[0:2])),
+		maxBlockSize:  int(binary.BigEndian.Uint16(block[2:4])),
+		minFrameSize:  int(block[4])<<16 | int(block[5])<<8 | int(block[6]),
+		maxFrameSize:  int(block[7])<<16 | int(block[8])<<8 | int(block[9]),
+		sampleRate:    int(packed >> 44),
+		channels:      int(packed>>41&0b111) + 1,
+		bitsPerSample: int(packed>>36&0b11111) + 1,
+		totalSamples:  packed & (1<<36 - 1),
+		signature:     block[18:],
+	}
+}
+
+// sine returns interleaved pcm of the tone with the channels shifted in phase.
+func sine(frames, channels int) []int16 {
+	pcm := make([]int16, 0, frames*channels)
+
+	for i := 0; i < frames; i++ {
+		for c := 0; c < channels; c++ {
+			pcm = append(pcm, int16(8000*math.Sin(float64(i)/20+float64(c))))
+		}
+	}
+
+	return pcm
+}
+
+func pcmSignature(pcm []int16) []byte {
+	raw := make([]byte, 0, len(pcm)*2)
+	for _, sample := range pcm {
+		raw = binary.LittleEndian.AppendUint16(raw, uint16(sample))
+	}
+
+	sum := md5.Sum(raw)
+
+	return sum[:]
+}
+
+func TestEncoderStreamInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   int
+		frames     int
+	}{
+		{name: "mono single block", sampleRate: 48000, channels: 1, frames: blockSize},
+		{name: "stereo single block", sampleRate: 48000, channels: 2, frames: blockSize},
+		{name: "stereo partial block", sampleRate: 44100, channels: 2, frames: 3*blockSize + 100},
+		{name: "mono shorter than block", sampleRate: 16000, channels: 1, frames: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Create(filepath.Join(t.TempDir(), "out.flac"))
+			if err != nil {
+				t.Fatalf("failed to create file: %v", err)
+			}
+
+			defer file.Close() // nolint: errcheck
+
+			encoder, err := NewEncoder(file, tt.sampleRate, tt.channels)
+			if err != nil {
+				t.Fatalf("failed to create encoder: %v", err)
+			}
+
+			pcm := sine(tt.frames, tt.channels)
+
+			// uneven chunks to cross block boundaries inside of writes
+			for chunk := pcm; len(chunk) > 0; {
+				n := min(len(chunk), 1000*tt.channels)
+				if err = encoder.Write(chunk[:n]); err != nil {
+					t.Fatalf("failed to write pcm: %v", err)
+				}
+
+				chunk = chunk[n:]
+			}
+
+			if err = encoder.Close(); err != nil {
+				t.Fatalf("failed to close encoder: %v", err)
+			}
+
+			data, err := os.ReadFile(file.Name())
+			if err != nil {
+				t.Fatalf("failed to read file: %v", err)
+			}
+
+			if offset, _ := file.Seek(0, io.SeekCurrent); offset != int64(len(data)) {
+				t.Errorf("output is left at %d, want the end at %d", offset, len(data))
+			}
+
+			info := parseStreamInfo(t, data)
+
+			if info.minBlockSize != blockSize || info.maxBlockSize != blockSize {
+				t.Errorf("block size = %d..%d, want %d", info.minBlockSize, info.maxBlockSize, blockSize)
+			}
+
+			if info.sampleRate != tt.sampleRate || info.channels != tt.channels || info.bitsPerSample != bitsPerSample {
+				t.Errorf("format = %d Hz, %d channels, %d bits", info.sampleRate, info.channels, info.bitsPerSample)
+			}
+
+			if info.totalSamples != uint64(tt.frames) {
+				t.Errorf("total samples = %d, want %d", info.totalSamples, tt.frames)
+			}
+
+			if !bytes.Equal(info.signature, pcmSignature(pcm)) {
+				t.Errorf("signature = %x, want %x", info.signature, pcmSignature(pcm))
+			}
+
+			framesSize := len(data) - 8 - streamInfoSize
+
+			if info.minFrameSize == 0 || info.minFrameSize > info.maxFrameSize || info.maxFrameSize > framesSize {
+				t.Errorf("frame size = %d..%d, frames take %d bytes", info.minFrameSize, info.maxFrameSize, framesSize)
+			}
+
+			if tt.frames <= blockSize && (info.minFrameSize != framesSize || info.maxFrameSize != framesSize) {
+				t.Errorf("frame size of the only frame = %d..%d, want %d", info.minFrameSize, info.maxFrameSize, framesSize)
+			}
+		})
+	}
+}
+
+func TestEncoderNotSeekable(t *testing.T) {
+	var out bytes.Buffer
+
+	encoder, err := NewEncoder(&out, 48000, 2)
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+
+	if err = encoder.Write(sine(blockSize+1, 2)); err != nil {
+		t.Fatalf("failed to write pcm: %v", err)
+	}
+
+	if err = encoder.Close(); err != nil {
+		t.Fatalf("failed to close encoder: %v", err)
+	}
+
+	info := parseStreamInfo(t, out.Bytes())
+
+	if info.totalSamples != 0 || info.minFrameSize != 0 || info.maxFrameSize != 0 {
+		t.Errorf("statistics of the unfinished stream are filled: %+v", info)
+	}
+
+	if !bytes.Equal(info.signature, make([]byte, md5.Size)) {
+		t.Errorf("signature of the unfinished stream is filled: %x", info.signature)
+	}
+}
+
+func TestEncoderEmpty(t *testing.T) {
+	var out bytes.Buffer
+
+	encoder, err := NewEncoder(&out, 48000, 1)
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+
+	if err = encoder.Close(); err != nil {
+		t.Fatalf("failed to close encoder: %v", err)
+	}
+
+	if out.Len() != 8+streamInfoSize {
+		t.Errorf("empty stream takes %d bytes, want only STREAMINFO", out.Len())
+	}
+}
+
+func TestNewEncoderChannels(t *testing.T) {
+	for _, channels := range []int{0, 3} {
+		if _, err := NewEncoder(io.Discard, 48000, channels); err == nil {
+			t.Errorf("encoder of %d channels is created", channels)
+		}
+	}
+}
+
+func TestCRC(t *testing.T) {
+	data := []byte("123456789")
+
+	// check values of the CRC catalogue for CRC-8/SMBUS and CRC-16/UMTS
+	if got := crc8(data); got != 0xF4 {
+		t.Errorf("crc8 = %#x, want 0xf4", got)
+	}
+
+	if got := crc16(data); got != 0xFEE8 {
+		t.Errorf("crc16 = %#x, want 0xfee8", got)
+	}
+}
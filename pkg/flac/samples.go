@@ -0,0 +1,160 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CountSamples returns number of samples (per channel) in the complete frames of the stream.
+// Total samples of STREAMINFO are not known until the encoder is closed, so the stream which
+// has been cut off is measured by its frames, and the truncated frame at the end is not counted.
+func CountSamples(in io.Reader) (uint64, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return 0, err
+	}
+
+	pos, err := skipMetadata(data)
+	if err != nil {
+		return 0, err
+	}
+
+	var total uint64
+
+	for pos < len(data) {
+		_, samples, ok := parseFrameHeader(data[pos:])
+		if !ok {
+			break
+		}
+
+		end := frameEnd(data, pos)
+		if end == -1 {
+			break
+		}
+
+		total += uint64(samples)
+		pos = end
+	}
+
+	return total, nil
+}
+
+// skipMetadata returns position of the first frame following the metadata blocks.
+func skipMetadata(data []byte) (int, error) {
+	if len(data) < 4 || string(data[:4]) != "fLaC" {
+		return 0, errors.New("stream does not start with fLaC marker")
+	}
+
+	pos := 4
+
+	for {
+		if len(data) < pos+4 {
+			return 0, errors.New("truncated metadata block")
+		}
+
+		last := data[pos]&0x80 != 0
+		length := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+
+		pos += 4 + length
+		if pos > len(data) {
+			return 0, fmt.Errorf("truncated metadata block of %d bytes", length)
+		}
+
+		if last {
+			return pos, nil
+		}
+	}
+}
+
+// frameEnd returns position where the frame starting at given position ends, that is the
+// next frame header or the end of the stream, after which CRC-16 of the frame matches.
+// It returns -1 if the frame is truncated.
+func frameEnd(data []byte, start int) int {
+	headerLength, _, _ := parseFrameHeader(data[start:])
+
+	for pos := start + headerLength; pos < len(data); pos++ {
+		if _, _, ok := parseFrameHeader(data[pos:]); ok && crc16(data[start:pos]) == 0 {
+			return pos
+		}
+	}
+
+	if crc16(data[start:]) == 0 {
+		return len(data)
+	}
+
+	return -1
+}
+
+// parseFrameHeader returns length of the frame header at the beginning of data and number
+// of samples in the frame. It reports whether there is a valid header.
+func parseFrameHeader(data []byte) (int, int, bool) {
+	// sync code, reserved bit and blocking strategy, 4 bytes of codes and CRC-8 at least
+	if len(data) < 6 || data[0] != 0xFF || data[1]&0xFE != 0xF8 {
+		return 0, 0, false
+	}
+
+	blockCode, rateCode := data[2]>>4, data[2]&0x0F
+	if blockCode == 0 || rateCode == 0b1111 || data[3]&1 != 0 {
+		return 0, 0, false
+	}
+
+	pos := 4
+
+	// frame or sample number in the "UTF-8" coding, number of leading ones is its length
+	length := 1
+	for b := data[pos]; b&0x80 != 0; b <<= 1 {
+		length++
+	}
+
+	switch {
+	case length == 2:
+		return 0, 0, false // continuation byte
+	case length > 2:
+		length--
+	}
+
+	if length > 7 {
+		return 0, 0, false
+	}
+
+	pos += length
+
+	var samples int
+
+	switch {
+	case blockCode == 0b0001:
+		samples = 192
+	case blockCode <= 0b0101:
+		samples = 576 << (blockCode - 2)
+	case blockCode == 0b0110:
+		if len(data) < pos+1 {
+			return 0, 0, false
+		}
+
+		samples = int(data[pos]) + 1
+		pos++
+	case blockCode == 0b0111:
+		if len(data) < pos+2 {
+			return 0, 0, false
+		}
+
+		samples = (int(data[pos])<<8 | int(data[pos+1])) + 1
+		pos += 2
+	default:
+		samples = 256 << (blockCode - 8)
+	}
+
+	switch rateCode {
+	case 0b1100:
+		pos++
+	case 0b1101, 0b1110:
+		pos += 2
+	}
+
+	if len(data) < pos+1 || crc8(data[:pos]) != data[pos] {
+		return 0, 0, false
+	}
+
+	return pos + 1, samples, true
+}
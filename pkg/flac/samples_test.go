@@ -0,0 +1,75 @@
+package flac
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encode returns stream of the pcm written by the encoder to the output which is not seekable.
+func encode(t *testing.T, pcm []int16, sampleRate, channels int) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	encoder, err := NewEncoder(&out, sampleRate, channels)
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+
+	if err = encoder.Write(pcm); err != nil {
+		t.Fatalf("failed to write pcm: %v", err)
+	}
+
+	if err = encoder.Close(); err != nil {
+		t.Fatalf("failed to close encoder: %v", err)
+	}
+
+	return out.Bytes()
+}
+
+func TestCountSamples(t *testing.T) {
+	tests := []struct {
+		name       string
+		pcm        []int16
+		sampleRate int
+		channels   int
+		cut        int // bytes cut off the end of the stream
+		want       uint64
+	}{
+		{name: "stereo", pcm: sine(3*blockSize+100, 2), sampleRate: 48000, channels: 2, want: 3*blockSize + 100},
+		{name: "mono", pcm: sine(blockSize, 1), sampleRate: 48000, channels: 1, want: blockSize},
+		{name: "silence", pcm: make([]int16, 2*(2*blockSize+1)), sampleRate: 48000, channels: 2, want: 2*blockSize + 1},
+		{name: "sample rate in header", pcm: sine(blockSize+10, 2), sampleRate: 22000, channels: 2, want: blockSize + 10},
+		{name: "truncated frame", pcm: sine(3*blockSize+100, 2), sampleRate: 48000, channels: 2, cut: 1, want: 3 * blockSize},
+		{name: "truncated full frame", pcm: sine(2*blockSize, 2), sampleRate: 48000, channels: 2, cut: 5, want: blockSize},
+		{name: "no frames", sampleRate: 48000, channels: 2, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encode(t, tt.pcm, tt.sampleRate, tt.channels)
+
+			samples, err := CountSamples(bytes.NewReader(data[:len(data)-tt.cut]))
+			if err != nil {
+				t.Fatalf("failed to count samples: %v", err)
+			}
+
+			if samples != tt.want {
+				t.Errorf("samples = %d, want %d", samples, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountSamplesInvalid(t *testing.T) {
+	data := encode(t, sine(blockSize, 2), 48000, 2)
+
+	for name, stream := range map[string][]byte{
+		"not flac":           []byte("OggS"),
+		"truncated metadata": data[:8+streamInfoSize-1],
+	} {
+		if _, err := CountSamples(bytes.NewReader(stream)); err == nil {
+			t.Errorf("%s: samples are counted", name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package loudness
+
+import (
+	"math"
+)
+
+// biquad is a second order IIR filter.
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	z1, z2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+
+	return y
+}
+
+// kWeighting is a K-weighting filter of BS.1770: high shelf modelling the head, followed by
+// high pass. Coefficients are derived for the sample rate, as they are given for 48kHz only.
+type kWeighting struct {
+	shelf    biquad
+	highPass biquad
+}
+
+func newKWeighting(sampleRate float64) kWeighting {
+	var w kWeighting
+
+	{
+		const (
+			f0   = 1681.974450955533
+			gain = 3.999843853973347
+			q    = 0.7071752369554196
+		)
+
+		k := math.Tan(math.Pi * f0 / sampleRate)
+		vh := math.Pow(10, gain/20)
+		vb := math.Pow(vh, 0.4996667741545416)
+		a0 := 1 + k/q + k*k
+
+		w.shelf = biquad{
+			b0: (vh + vb*k/q + k*k) / a0,
+			b1: 2 * (k*k - vh) / a0,
+			b2: (vh - vb*k/q + k*k) / a0,
+			a1: 2 * (k*k - 1) / a0,
+			a2: (1 - k/q + k*k) / a0,
+		}
+	}
+
+	{
+		const (
+			f0 = 38.13547087602444
+			q  = 0.5003270373238773
+		)
+
+		k := math.Tan(math.Pi * f0 / sampleRate)
+		a0 := 1 + k/q + k*k
+
+		w.highPass = biquad{
+			b0: 1,
+			b1: -2,
+			b2: 1,
+			a1: 2 * (k*k - 1) / a0,
+			a2: (1 - k/q + k*k) / a0,
+		}
+	}
+
+	return w
+}
+
+func (w *kWeighting) process(x float64) float64 {
+	return w.highPass.process(w.shelf.process(x))
+}
+
+const (
+	// oversampling is how many times audio is upsampled to find peaks between samples.
+	oversampling = 4
+	// phaseTaps is a length of every phase of the interpolation filter.
+	phaseTaps = 12
+)
+
+// interpolation is a polyphase windowed sinc low pass filter upsampling audio by oversampling times.
+var interpolation = func() [oversampling][phaseTaps]float64 {
+	const taps = oversampling * phaseTaps
+
+	var phases [oversampling][phaseTaps]float64
+
+	for phase := 0; phase < oversampling; phase++ {
+		var sum float64
+
+		for tap := 0; tap < phaseTaps; tap++ {
+			n := float64(tap*oversampling+phase) - (taps-1)/2.0
+
+			coefficient := 1.0
+			if x := math.Pi * n / oversampling; x != 0 {
+				coefficient = math.Sin(x) / x
+			}
+
+			// Hann window
+			coefficient *= 0.5 - 0.5*math.Cos(2*math.Pi*(float64(tap*oversampling+phase)+0.5)/taps)
+
+			phases[phase][tap] = coefficient
+			sum += coefficient
+		}
+
+		// every phase passes constant signal as is
+		for tap := range phases[phase] {
+			phases[phase][tap] /= sum
+		}
+	}
+
+	return phases
+}()
+
+// upsampler finds true peak of a single channel (BS.1770, annex 2).
+type upsampler struct {
+	history [phaseTaps]float64 // last samples, the most recent first
+}
+
+// peak returns the largest absolute value of the signal interpolated between the previous
+// samples and the new one.
+func (u *upsampler) peak(sample float64) float64 {
+	copy(u.history[1:], u.history[:phaseTaps-1])
+	u.history[0] = sample
+
+	peak := math.Abs(sample)
+
+	for phase := range interpolation {
+		var value float64
+		for tap, coefficient := range interpolation[phase] {
+			value += coefficient * u.history[tap]
+		}
+
+		peak = max(peak, math.Abs(value))
+	}
+
+	return peak
+}
@@ -0,0 +1,138 @@
+// Package loudness measures loudness of audio as specified by ITU-R BS.1770-4 and EBU R128.
+package loudness
+
+import (
+	"math"
+)
+
+const (
+	// absoluteGate is a loudness (in LUFS) below which blocks are not taken into account.
+	absoluteGate = -70.0
+	// relativeGate is how far below the ungated loudness (in LU) blocks are not taken into account.
+	relativeGate = -10.0
+
+	// blocks of 400ms overlap by 75%, so they are summed up from 100ms steps
+	stepsPerBlock = 4
+)
+
+// Meter measures integrated loudness and true peak of interleaved 16-bit pcm. Every channel
+// is weighted equally, which is correct for mono and stereo audio.
+type Meter struct {
+	channels   int
+	stepSize   int // number of samples (per channel) in 100ms
+	filters    []kWeighting
+	upsamplers []upsampler
+
+	stepEnergy  float64   // sum of squared weighted samples of the current step
+	stepSamples int       // number of samples (per channel) in the current step
+	steps       []float64 // mean square of the last steps which make up the block
+	blocks      []float64 // mean square of every block
+
+	peak float64 // true peak in linear scale
+}
+
+func NewMeter(sampleRate, channels int) *Meter {
+	m := &Meter{
+		channels:   channels,
+		stepSize:   sampleRate / 10,
+		filters:    make([]kWeighting, channels),
+		upsamplers: make([]upsampler, channels),
+	}
+
+	for c := range m.filters {
+		m.filters[c] = newKWeighting(float64(sampleRate))
+	}
+
+	return m
+}
+
+// Write measures the next piece of audio.
+func (m *Meter) Write(pcm []int16) {
+	for i := 0; i+m.channels <= len(pcm); i += m.channels {
+		for c := 0; c < m.channels; c++ {
+			sample := float64(pcm[i+c]) / math.MaxInt16
+
+			weighted := m.filters[c].process(sample)
+			m.stepEnergy += weighted * weighted
+
+			m.peak = max(m.peak, m.upsamplers[c].peak(sample))
+		}
+
+		m.stepSamples++
+		if m.stepSamples == m.stepSize {
+			m.finishStep()
+		}
+	}
+}
+
+func (m *Meter) finishStep() {
+	m.steps = append(m.steps, m.stepEnergy/float64(m.stepSamples))
+	if len(m.steps) > stepsPerBlock {
+		m.steps = m.steps[1:]
+	}
+
+	m.stepEnergy = 0
+	m.stepSamples = 0
+
+	if len(m.steps) < stepsPerBlock {
+		return
+	}
+
+	var block float64
+	for _, step := range m.steps {
+		block += step
+	}
+
+	m.blocks = append(m.blocks, block/stepsPerBlock)
+}
+
+// Integrated returns gated integrated loudness (in LUFS) of the audio written so far.
+// It is negative infinity if there is nothing loud enough to be measured.
+func (m *Meter) Integrated() float64 {
+	threshold := energy(absoluteGate)
+
+	ungated := gatedMean(m.blocks, threshold)
+	if ungated == 0 {
+		return math.Inf(-1)
+	}
+
+	threshold = max(threshold, energy(loudness(ungated)+relativeGate))
+
+	return loudness(gatedMean(m.blocks, threshold))
+}
+
+// TruePeak returns the true peak (in dBTP) of the audio written so far.
+func (m *Meter) TruePeak() float64 {
+	return 20 * math.Log10(m.peak)
+}
+
+// gatedMean returns mean of the blocks above the threshold, or zero if there are none.
+func gatedMean(blocks []float64, threshold float64) float64 {
+	var (
+		sum   float64
+		count int
+	)
+
+	for _, block := range blocks {
+		if block > threshold {
+			sum += block
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return sum / float64(count)
+}
+
+// loudness converts mean square of the block to the loudness.
+func loudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// energy converts loudness to the mean square of the block.
+func energy(loudness float64) float64 {
+	return math.Pow(10, (loudness+0.691)/10)
+}
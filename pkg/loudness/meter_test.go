@@ -0,0 +1,178 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const sampleRate = 48000
+
+// tone is a sine played on every channel.
+type tone struct {
+	frequency float64 // in Hz
+	level     float64 // peak amplitude (in dBFS)
+	duration  time.Duration
+	phase     float64 // in radians
+}
+
+// render returns interleaved pcm of the tones played one after another.
+func render(channels int, tones ...tone) []int16 {
+	var pcm []int16
+
+	for _, t := range tones {
+		amplitude := math.Pow(10, t.level/20) * math.MaxInt16
+		samples := int(t.duration.Seconds() * sampleRate)
+
+		for i := 0; i < samples; i++ {
+			sample := int16(math.Round(amplitude * math.Sin(2*math.Pi*t.frequency*float64(i)/sampleRate+t.phase)))
+
+			for c := 0; c < channels; c++ {
+				pcm = append(pcm, sample)
+			}
+		}
+	}
+
+	return pcm
+}
+
+// Reference signals are the ones of EBU Tech 3341, loudness is measured within 0.1 LU.
+func TestMeterIntegrated(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		tones    []tone
+		want     float64
+	}{
+		{
+			name:     "stereo -23 dBFS",
+			channels: 2,
+			tones:    []tone{{frequency: 1000, level: -23, duration: 20 * time.Second}},
+			want:     -23,
+		},
+		{
+			name:     "stereo -33 dBFS",
+			channels: 2,
+			tones:    []tone{{frequency: 1000, level: -33, duration: 20 * time.Second}},
+			want:     -33,
+		},
+		{
+			name:     "mono is half of the stereo energy",
+			channels: 1,
+			tones:    []tone{{frequency: 1000, level: -23, duration: 20 * time.Second}},
+			want:     -26,
+		},
+		{
+			name:     "relative gate",
+			channels: 2,
+			tones: []tone{
+				{frequency: 1000, level: -36, duration: 10 * time.Second},
+				{frequency: 1000, level: -23, duration: 60 * time.Second},
+				{frequency: 1000, level: -36, duration: 10 * time.Second},
+			},
+			want: -23,
+		},
+		{
+			name:     "absolute gate",
+			channels: 2,
+			tones: []tone{
+				{frequency: 1000, level: -72, duration: 10 * time.Second},
+				{frequency: 1000, level: -36, duration: 10 * time.Second},
+				{frequency: 1000, level: -23, duration: 60 * time.Second},
+				{frequency: 1000, level: -36, duration: 10 * time.Second},
+				{frequency: 1000, level: -72, duration: 10 * time.Second},
+			},
+			want: -23,
+		},
+		{
+			name:     "levels are averaged",
+			channels: 2,
+			tones: []tone{
+				{frequency: 1000, level: -26, duration: 20 * time.Second},
+				{frequency: 1000, level: -20, duration: 20100 * time.Millisecond},
+				{frequency: 1000, level: -26, duration: 20 * time.Second},
+			},
+			want: -23,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := NewMeter(sampleRate, tt.channels)
+			meter.Write(render(tt.channels, tt.tones...))
+
+			if got := meter.Integrated(); math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("integrated loudness = %.2f LUFS, want %.1f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeterIntegratedSilence(t *testing.T) {
+	tests := []struct {
+		name  string
+		tones []tone
+	}{
+		{name: "nothing written"},
+		{name: "silence", tones: []tone{{frequency: 1000, level: math.Inf(-1), duration: 5 * time.Second}}},
+		{name: "below absolute gate", tones: []tone{{frequency: 1000, level: -80, duration: 5 * time.Second}}},
+		{name: "shorter than block", tones: []tone{{frequency: 1000, level: -23, duration: 300 * time.Millisecond}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := NewMeter(sampleRate, 2)
+			meter.Write(render(2, tt.tones...))
+
+			if got := meter.Integrated(); !math.IsInf(got, -1) {
+				t.Errorf("integrated loudness = %.2f LUFS, want nothing measured", got)
+			}
+		})
+	}
+}
+
+// Reference signals are the ones of EBU Tech 3341 at 48kHz, true peak is measured
+// within +0.2/-0.4 dB of the peak of the analog signal, which is missed by the samples.
+func TestMeterTruePeak(t *testing.T) {
+	tests := []struct {
+		name string
+		tone tone
+		want float64
+	}{
+		{name: "samples at peaks", tone: tone{frequency: 1000, level: -6}, want: -6},
+		{name: "quarter of sample rate", tone: tone{frequency: sampleRate / 4, level: -6, phase: math.Pi / 4}, want: -6},
+		{name: "third of sample rate", tone: tone{frequency: sampleRate / 3, level: -6}, want: -6},
+		{name: "sixth of sample rate", tone: tone{frequency: sampleRate / 6, level: -6, phase: math.Pi / 6}, want: -6},
+		{name: "near full scale", tone: tone{frequency: sampleRate / 4, level: 0, phase: math.Pi / 4}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.tone.duration = time.Second
+
+			meter := NewMeter(sampleRate, 2)
+			meter.Write(render(2, tt.tone))
+
+			if got := meter.TruePeak(); got < tt.want-0.4 || got > tt.want+0.2 {
+				t.Errorf("true peak = %.2f dBTP, want %.1f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeterTruePeakAboveSamplePeak(t *testing.T) {
+	// samples of the tone miss its peaks by 3 dB
+	pcm := render(1, tone{frequency: sampleRate / 4, level: -6, duration: time.Second, phase: math.Pi / 4})
+
+	var samplePeak float64
+	for _, sample := range pcm {
+		samplePeak = max(samplePeak, math.Abs(float64(sample))/math.MaxInt16)
+	}
+
+	meter := NewMeter(sampleRate, 1)
+	meter.Write(pcm)
+
+	if truePeak, sampleLevel := meter.TruePeak(), 20*math.Log10(samplePeak); truePeak < sampleLevel+2.5 {
+		t.Errorf("true peak %.2f dBTP is not above the sample peak %.2f dBFS", truePeak, sampleLevel)
+	}
+}
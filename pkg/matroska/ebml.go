@@ -0,0 +1,111 @@
+package matroska
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// element IDs used by the writer
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+
+	idSegment        = 0x18538067
+	idInfo           = 0x1549A966
+	idTimestampScale = 0x2AD7B1
+	idDuration       = 0x4489
+	idTitle          = 0x7BA9
+	idMuxingApp      = 0x4D80
+	idWritingApp     = 0x5741
+
+	idTracks            = 0x1654AE6B
+	idTrackEntry        = 0xAE
+	idTrackNumber       = 0xD7
+	idTrackUID          = 0x73C5
+	idTrackType         = 0x83
+	idFlagLacing        = 0x9C
+	idName              = 0x536E
+	idLanguage          = 0x22B59C
+	idCodecID           = 0x86
+	idCodecPrivate      = 0x63A2
+	idCodecDelay        = 0x56AA
+	idSeekPreRoll       = 0x56BB
+	idAudio             = 0xE1
+	idSamplingFrequency = 0xB5
+	idChannels          = 0x9F
+
+	idCluster     = 0x1F43B675
+	idTimestamp   = 0xE7
+	idSimpleBlock = 0xA3
+)
+
+// unknownSize is a size of the element which is not known in advance.
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// appendID appends element ID, which is stored with its length marker.
+func appendID(data []byte, id uint32) []byte {
+	switch {
+	case id > 0xFFFFFF:
+		return append(data, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFFFF:
+		return append(data, byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFF:
+		return append(data, byte(id>>8), byte(id))
+	default:
+		return append(data, byte(id))
+	}
+}
+
+// appendSize appends variable length integer with the element data size.
+func appendSize(data []byte, size uint64) []byte {
+	length := 1
+	for length < 8 && size >= 1<<(7*length)-1 {
+		length++
+	}
+
+	for i := length - 1; i >= 0; i-- {
+		b := byte(size >> (8 * i))
+		if i == length-1 {
+			b |= 0x80 >> (length - 1)
+		}
+
+		data = append(data, b)
+	}
+
+	return data
+}
+
+func appendElement(data []byte, id uint32, payload []byte) []byte {
+	data = appendID(data, id)
+	data = appendSize(data, uint64(len(payload)))
+
+	return append(data, payload...)
+}
+
+func appendUint(data []byte, id uint32, value uint64) []byte {
+	length := 1
+	for length < 8 && value >= 1<<(8*length) {
+		length++
+	}
+
+	payload := make([]byte, length)
+	for i := range payload {
+		payload[i] = byte(value >> (8 * (length - 1 - i)))
+	}
+
+	return appendElement(data, id, payload)
+}
+
+func appendFloat(data []byte, id uint32, value float64) []byte {
+	return appendElement(data, id, binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+}
+
+func appendString(data []byte, id uint32, value string) []byte {
+	return appendElement(data, id, []byte(value))
+}
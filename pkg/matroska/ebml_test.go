@@ -0,0 +1,63 @@
+package matroska
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendSize(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want []byte
+	}{
+		{size: 0, want: []byte{0x80}},
+		{size: 126, want: []byte{0xFE}},
+		// all ones are reserved for the unknown size, so the longer form is used
+		{size: 127, want: []byte{0x40, 0x7F}},
+		{size: 16382, want: []byte{0x7F, 0xFE}},
+		{size: 16383, want: []byte{0x20, 0x3F, 0xFF}},
+		{size: 1 << 40, want: []byte{0x05, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		if got := appendSize(nil, tt.size); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendSize(%d) = %x, want %x", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestAppendID(t *testing.T) {
+	tests := []struct {
+		id   uint32
+		want []byte
+	}{
+		{id: idSimpleBlock, want: []byte{0xA3}},
+		{id: idDuration, want: []byte{0x44, 0x89}},
+		{id: idTimestampScale, want: []byte{0x2A, 0xD7, 0xB1}},
+		{id: idEBML, want: []byte{0x1A, 0x45, 0xDF, 0xA3}},
+	}
+
+	for _, tt := range tests {
+		if got := appendID(nil, tt.id); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendID(%#x) = %x, want %x", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestAppendUint(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []byte
+	}{
+		{value: 0, want: []byte{0xD7, 0x81, 0x00}},
+		{value: 255, want: []byte{0xD7, 0x81, 0xFF}},
+		{value: 256, want: []byte{0xD7, 0x82, 0x01, 0x00}},
+		{value: 1 << 63, want: []byte{0xD7, 0x88, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		if got := appendUint(nil, idTrackNumber, tt.value); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendUint(%d) = %x, want %x", tt.value, got, tt.want)
+		}
+	}
+}
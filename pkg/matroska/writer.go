@@ -0,0 +1,176 @@
+// Package matroska implements writer of Matroska and WebM files with Opus audio tracks.
+package matroska
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+// DocType is a flavour of the written file.
+type DocType string
+
+const (
+	DocTypeMatroska DocType = "matroska"
+	DocTypeWebM     DocType = "webm"
+)
+
+const (
+	// clusters are started often enough to keep relative block timestamps in int16 milliseconds
+	maxClusterDuration = 5 * time.Second
+	maxClusterSize     = 1 << 20
+
+	seekPreRoll = 80 * time.Millisecond // recommended for Opus
+)
+
+var ErrUnorderedBlock = errors.New("block is older than the cluster")
+
+// Track is an Opus audio track.
+type Track struct {
+	Name       string
+	Head       []byte // OpusHead packet, used as codec private data
+	CodecDelay time.Duration
+	SampleRate float64
+	Channels   uint64
+}
+
+// Header holds information written before any block.
+type Header struct {
+	DocType  DocType
+	Title    string
+	Duration time.Duration
+	Tracks   []Track
+}
+
+// Writer writes blocks of the tracks into clusters. Blocks must be written in order of their
+// timestamps. Segment is written with unknown size, so the output does not have to be seekable.
+type Writer struct {
+	out io.Writer
+
+	cluster          []byte // blocks of the cluster being filled
+	clusterTimestamp time.Duration
+	clusterStarted   bool
+}
+
+func NewWriter(out io.Writer, header Header) (*Writer, error) {
+	w := &Writer{out: out}
+
+	if err := w.writeHeader(header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return w, nil
+}
+
+func (w *Writer) writeHeader(header Header) error {
+	var ebml []byte
+
+	ebml = appendUint(ebml, idEBMLVersion, 1)
+	ebml = appendUint(ebml, idEBMLReadVersion, 1)
+	ebml = appendUint(ebml, idEBMLMaxIDLength, 4)
+	ebml = appendUint(ebml, idEBMLMaxSizeLength, 8)
+	ebml = appendString(ebml, idDocType, string(header.DocType))
+	ebml = appendUint(ebml, idDocTypeVersion, 4)
+	ebml = appendUint(ebml, idDocTypeReadVersion, 2)
+
+	data := appendElement(nil, idEBML, ebml)
+
+	data = appendID(data, idSegment)
+	data = append(data, unknownSize...)
+
+	var info []byte
+
+	info = appendUint(info, idTimestampScale, uint64(time.Millisecond))
+	info = appendFloat(info, idDuration, float64(header.Duration.Milliseconds()))
+	if len(header.Title) != 0 {
+		info = appendString(info, idTitle, header.Title)
+	}
+	info = appendString(info, idMuxingApp, "voicelog")
+	info = appendString(info, idWritingApp, "voicelog")
+
+	data = appendElement(data, idInfo, info)
+
+	var tracks []byte
+
+	for i, track := range header.Tracks {
+		var entry []byte
+
+		entry = appendUint(entry, idTrackNumber, uint64(i+1))
+		entry = appendUint(entry, idTrackUID, rand.Uint64()|1)
+		entry = appendUint(entry, idTrackType, 2) // audio
+		entry = appendUint(entry, idFlagLacing, 0)
+		entry = appendString(entry, idName, track.Name)
+		entry = appendString(entry, idLanguage, "und")
+		entry = appendString(entry, idCodecID, "A_OPUS")
+		entry = appendElement(entry, idCodecPrivate, track.Head)
+		entry = appendUint(entry, idCodecDelay, uint64(track.CodecDelay.Nanoseconds()))
+		entry = appendUint(entry, idSeekPreRoll, uint64(seekPreRoll.Nanoseconds()))
+
+		var audio []byte
+
+		audio = appendFloat(audio, idSamplingFrequency, track.SampleRate)
+		audio = appendUint(audio, idChannels, track.Channels)
+
+		entry = appendElement(entry, idAudio, audio)
+
+		tracks = appendElement(tracks, idTrackEntry, entry)
+	}
+
+	data = appendElement(data, idTracks, tracks)
+
+	_, err := w.out.Write(data)
+
+	return err
+}
+
+// WriteBlock writes frame of the track (numbered from 1 in order of the header tracks).
+func (w *Writer) WriteBlock(track int, timestamp time.Duration, frame []byte) error {
+	if w.clusterStarted && timestamp < w.clusterTimestamp {
+		return ErrUnorderedBlock
+	}
+
+	if !w.clusterStarted || timestamp-w.clusterTimestamp >= maxClusterDuration || len(w.cluster) >= maxClusterSize {
+		if err := w.flushCluster(); err != nil {
+			return err
+		}
+
+		w.clusterTimestamp = timestamp.Truncate(time.Millisecond)
+		w.clusterStarted = true
+	}
+
+	relative := (timestamp - w.clusterTimestamp).Milliseconds()
+
+	block := appendSize(nil, uint64(track))
+	block = append(block, byte(relative>>8), byte(relative))
+	block = append(block, 0x80) // keyframe, every opus frame can be decoded independently
+
+	block = append(block, frame...)
+
+	w.cluster = appendElement(w.cluster, idSimpleBlock, block)
+
+	return nil
+}
+
+// Close writes the last cluster. It does not close the output.
+func (w *Writer) Close() error {
+	return w.flushCluster()
+}
+
+func (w *Writer) flushCluster() error {
+	if len(w.cluster) == 0 {
+		return nil
+	}
+
+	payload := appendUint(nil, idTimestamp, uint64(w.clusterTimestamp.Milliseconds()))
+	payload = append(payload, w.cluster...)
+
+	if _, err := w.out.Write(appendElement(nil, idCluster, payload)); err != nil {
+		return fmt.Errorf("failed to write cluster: %w", err)
+	}
+
+	w.cluster = w.cluster[:0]
+
+	return nil
+}
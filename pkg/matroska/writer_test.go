@@ -0,0 +1,244 @@
+package matroska
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"testing"
+	"time"
+)
+
+type element struct {
+	id          uint32
+	unknownSize bool
+	data        []byte
+}
+
+// readVint reads variable length integer, keeping the length marker if it is an element ID.
+func readVint(t *testing.T, data []byte, keepMarker bool) (uint64, int, bool) {
+	t.Helper()
+
+	if len(data) == 0 || data[0] == 0 {
+		t.Fatalf("invalid variable length integer: %x", data)
+	}
+
+	length := bits.LeadingZeros8(data[0]) + 1
+	if len(data) < length {
+		t.Fatalf("truncated variable length integer: %x", data)
+	}
+
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= 0xFF >> length
+	}
+
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, length, !keepMarker && value == 1<<(7*length)-1
+}
+
+// readElements reads sequence of elements, element of unknown size takes the rest of the data.
+func readElements(t *testing.T, data []byte) []element {
+	t.Helper()
+
+	var elements []element
+
+	for len(data) > 0 {
+		id, idLength, _ := readVint(t, data, true)
+		size, sizeLength, unknown := readVint(t, data[idLength:], false)
+
+		data = data[idLength+sizeLength:]
+
+		if unknown {
+			size = uint64(len(data))
+		}
+
+		if uint64(len(data)) < size {
+			t.Fatalf("element %#x of %d bytes is truncated to %d", id, size, len(data))
+		}
+
+		elements = append(elements, element{id: uint32(id), unknownSize: unknown, data: data[:size]})
+		data = data[size:]
+	}
+
+	return elements
+}
+
+func findElements(t *testing.T, data []byte, id uint32) []element {
+	t.Helper()
+
+	var found []element
+
+	for _, e := range readElements(t, data) {
+		if e.id == id {
+			found = append(found, e)
+		}
+	}
+
+	return found
+}
+
+func findElement(t *testing.T, data []byte, id uint32) element {
+	t.Helper()
+
+	found := findElements(t, data, id)
+	if len(found) != 1 {
+		t.Fatalf("found %d elements %#x, want 1", len(found), id)
+	}
+
+	return found[0]
+}
+
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
+
+type block struct {
+	track     int
+	timestamp time.Duration
+	frame     []byte
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+
+	header := Header{
+		DocType:  DocTypeWebM,
+		Title:    "standup",
+		Duration: 12 * time.Second,
+		Tracks: []Track{
+			{Name: "alice", Head: []byte("OpusHead1"), CodecDelay: 80 * time.Millisecond, SampleRate: 48000, Channels: 2},
+			{Name: "bob", Head: []byte("OpusHead2"), CodecDelay: 80 * time.Millisecond, SampleRate: 48000, Channels: 2},
+		},
+	}
+
+	writer, err := NewWriter(&out, header)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	var written []block
+
+	// 20 ms frames of both tracks for 12 seconds need three clusters
+	for i := 0; i < 600; i++ {
+		for track := 1; track <= 2; track++ {
+			b := block{track: track, timestamp: time.Duration(i) * 20 * time.Millisecond, frame: []byte{byte(track), byte(i)}}
+			written = append(written, b)
+
+			if err = writer.WriteBlock(b.track, b.timestamp, b.frame); err != nil {
+				t.Fatalf("failed to write block: %v", err)
+			}
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		t.Fatalf("failed to close writer: %v", err)
+	}
+
+	ebml := findElement(t, out.Bytes(), idEBML)
+	if docType := findElement(t, ebml.data, idDocType); string(docType.data) != "webm" {
+		t.Errorf("doc type = %q, want webm", docType.data)
+	}
+
+	segment := findElement(t, out.Bytes(), idSegment)
+	if !segment.unknownSize {
+		t.Errorf("segment is written with known size")
+	}
+
+	info := findElement(t, segment.data, idInfo)
+
+	if title := findElement(t, info.data, idTitle); string(title.data) != header.Title {
+		t.Errorf("title = %q, want %q", title.data, header.Title)
+	}
+
+	duration := findElement(t, info.data, idDuration)
+	if got := math.Float64frombits(binary.BigEndian.Uint64(duration.data)); got != 12000 {
+		t.Errorf("duration = %v ms, want 12000", got)
+	}
+
+	entries := findElements(t, findElement(t, segment.data, idTracks).data, idTrackEntry)
+	if len(entries) != len(header.Tracks) {
+		t.Fatalf("found %d tracks, want %d", len(entries), len(header.Tracks))
+	}
+
+	for i, entry := range entries {
+		if number := readUint(findElement(t, entry.data, idTrackNumber).data); number != uint64(i+1) {
+			t.Errorf("track number = %d, want %d", number, i+1)
+		}
+
+		if name := findElement(t, entry.data, idName); string(name.data) != header.Tracks[i].Name {
+			t.Errorf("track name = %q, want %q", name.data, header.Tracks[i].Name)
+		}
+
+		if private := findElement(t, entry.data, idCodecPrivate); !bytes.Equal(private.data, header.Tracks[i].Head) {
+			t.Errorf("codec private = %q, want %q", private.data, header.Tracks[i].Head)
+		}
+	}
+
+	clusters := findElements(t, segment.data, idCluster)
+	if len(clusters) != 3 {
+		t.Errorf("found %d clusters, want 3", len(clusters))
+	}
+
+	var read []block
+
+	for _, cluster := range clusters {
+		clusterTimestamp := time.Duration(readUint(findElement(t, cluster.data, idTimestamp).data)) * time.Millisecond
+
+		for _, simpleBlock := range findElements(t, cluster.data, idSimpleBlock) {
+			track, length, _ := readVint(t, simpleBlock.data, false)
+			relative := int16(binary.BigEndian.Uint16(simpleBlock.data[length:]))
+
+			if flags := simpleBlock.data[length+2]; flags != 0x80 {
+				t.Errorf("block flags = %#x, want keyframe", flags)
+			}
+
+			read = append(read, block{
+				track:     int(track),
+				timestamp: clusterTimestamp + time.Duration(relative)*time.Millisecond,
+				frame:     simpleBlock.data[length+3:],
+			})
+		}
+	}
+
+	if len(read) != len(written) {
+		t.Fatalf("read %d blocks, want %d", len(read), len(written))
+	}
+
+	for i := range written {
+		if read[i].track != written[i].track || read[i].timestamp != written[i].timestamp || !bytes.Equal(read[i].frame, written[i].frame) {
+			t.Fatalf("block %d = %+v, want %+v", i, read[i], written[i])
+		}
+	}
+}
+
+func TestWriterUnorderedBlock(t *testing.T) {
+	var out bytes.Buffer
+
+	writer, err := NewWriter(&out, Header{DocType: DocTypeMatroska})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	if err = writer.WriteBlock(1, time.Second, []byte{1}); err != nil {
+		t.Fatalf("failed to write block: %v", err)
+	}
+
+	// blocks of other tracks may be slightly behind within the cluster
+	if err = writer.WriteBlock(2, 1500*time.Millisecond, []byte{2}); err != nil {
+		t.Fatalf("failed to write block: %v", err)
+	}
+
+	if err = writer.WriteBlock(2, 500*time.Millisecond, []byte{3}); !errors.Is(err, ErrUnorderedBlock) {
+		t.Errorf("block older than the cluster: got %v, want %v", err, ErrUnorderedBlock)
+	}
+}
@@ -0,0 +1,32 @@
+package oggopus
+
+// crcTable is a lookup table for the CRC-32 used by Ogg (polynomial 0x04c11db7, no reflection).
+var crcTable = func() [256]uint32 {
+	var table [256]uint32
+
+	for i := range table {
+		r := uint32(i) << 24
+
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = (r << 1) ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+
+		table[i] = r
+	}
+
+	return table
+}()
+
+func crc32(data []byte) uint32 {
+	var crc uint32
+
+	for _, b := range data {
+		crc = (crc << 8) ^ crcTable[byte(crc>>24)^b]
+	}
+
+	return crc
+}
@@ -0,0 +1,134 @@
+package oggopus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	headSignature = "OpusHead"
+	tagsSignature = "OpusTags"
+
+	// DefaultPreSkip is a pre-skip recommended by RFC 7845 for streams which do not
+	// start at the beginning of the encoder output.
+	DefaultPreSkip = 3840
+)
+
+var ErrInvalidHeader = errors.New("invalid opus header")
+
+// Head is an identification header of the Ogg Opus stream (RFC 7845, section 5.1).
+// Only channel mapping family 0 (mono or stereo) is supported.
+type Head struct {
+	Channels        uint8
+	PreSkip         uint16
+	InputSampleRate uint32
+	OutputGain      int16 // Q7.8 gain in dB applied by decoder
+}
+
+// Marshal returns OpusHead packet.
+func (h Head) Marshal() []byte {
+	data := make([]byte, 19)
+
+	copy(data, headSignature)
+	data[8] = 1 // version
+	data[9] = h.Channels
+	binary.LittleEndian.PutUint16(data[10:], h.PreSkip)
+	binary.LittleEndian.PutUint32(data[12:], h.InputSampleRate)
+	binary.LittleEndian.PutUint16(data[16:], uint16(h.OutputGain))
+	data[18] = 0 // channel mapping family
+
+	return data
+}
+
+func parseHead(data []byte) (Head, error) {
+	if len(data) < 19 || string(data[:8]) != headSignature {
+		return Head{}, fmt.Errorf("%w: bad OpusHead packet", ErrInvalidHeader)
+	}
+
+	// major version is kept in the upper four bits, only version 1 streams are known
+	if data[8]&0xF0 != 0 {
+		return Head{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, data[8])
+	}
+
+	return Head{
+		Channels:        data[9],
+		PreSkip:         binary.LittleEndian.Uint16(data[10:]),
+		InputSampleRate: binary.LittleEndian.Uint32(data[12:]),
+		OutputGain:      int16(binary.LittleEndian.Uint16(data[16:])),
+	}, nil
+}
+
+// Tags is a comment header of the Ogg Opus stream (RFC 7845, section 5.2).
+type Tags struct {
+	Vendor   string
+	Comments []string // comments in the "KEY=value" form
+}
+
+func (t Tags) marshal() []byte {
+	size := 8 + 4 + len(t.Vendor) + 4
+	for _, comment := range t.Comments {
+		size += 4 + len(comment)
+	}
+
+	data := make([]byte, 0, size)
+
+	data = append(data, tagsSignature...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(t.Vendor)))
+	data = append(data, t.Vendor...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(t.Comments)))
+
+	for _, comment := range t.Comments {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(comment)))
+		data = append(data, comment...)
+	}
+
+	return data
+}
+
+func parseTags(data []byte) (Tags, error) {
+	if len(data) < 16 || string(data[:8]) != tagsSignature {
+		return Tags{}, fmt.Errorf("%w: bad OpusTags packet", ErrInvalidHeader)
+	}
+
+	data = data[8:]
+
+	readString := func() (string, bool) {
+		if len(data) < 4 {
+			return "", false
+		}
+
+		length := binary.LittleEndian.Uint32(data)
+		if uint64(len(data)-4) < uint64(length) {
+			return "", false
+		}
+
+		value := string(data[4 : 4+length])
+		data = data[4+length:]
+
+		return value, true
+	}
+
+	var (
+		tags Tags
+		ok   bool
+	)
+
+	if tags.Vendor, ok = readString(); !ok || len(data) < 4 {
+		return Tags{}, fmt.Errorf("%w: truncated OpusTags packet", ErrInvalidHeader)
+	}
+
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	for i := uint32(0); i < count; i++ {
+		comment, ok := readString()
+		if !ok {
+			return Tags{}, fmt.Errorf("%w: truncated OpusTags packet", ErrInvalidHeader)
+		}
+
+		tags.Comments = append(tags.Comments, comment)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,251 @@
+// Package oggopus implements Ogg Opus container (RFC 7845) muxer and reader.
+package oggopus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+)
+
+const (
+	// pages are flushed when they hold this much payload or audio, so that pages
+	// stay small enough for seeking and for losing not much on abrupt termination.
+	maxPagePayload = 4096
+	maxPageSamples = 48000
+
+	vendor = "voicelog"
+)
+
+var (
+	ErrStreamsSealed = errors.New("streams can not be added after packets were written")
+	ErrMuxerClosed   = errors.New("muxer is closed")
+)
+
+// Muxer writes one or more multiplexed (grouped) logical Ogg Opus streams into the writer.
+// All streams must be added before the first packet is written, because beginning of stream
+// pages of grouped streams must precede any other pages.
+type Muxer struct {
+	out io.Writer
+
+	streams        []*Stream
+	headersWritten bool
+	closed         bool
+}
+
+func NewMuxer(out io.Writer) *Muxer {
+	return &Muxer{out: out}
+}
+
+// Stream is a single logical stream of the Muxer.
+type Stream struct {
+	muxer *Muxer
+
+	head Head
+	tags Tags
+
+	serial   uint32
+	sequence uint32
+	granule  uint64 // granule position of the last packet written
+
+	page        page   // page being filled
+	pageSamples int    // audio duration of the packets finished on the page being filled
+	pageHasEnd  bool   // whether any packet is finished on the page being filled
+	pageGranule uint64 // granule position of the last packet finished on the page being filled
+}
+
+// AddStream adds new logical stream with given headers to the muxer.
+func (m *Muxer) AddStream(head Head, tags Tags) (*Stream, error) {
+	if m.headersWritten {
+		return nil, ErrStreamsSealed
+	}
+
+	if tags.Vendor == "" {
+		tags.Vendor = vendor
+	}
+
+	stream := &Stream{
+		muxer:  m,
+		head:   head,
+		tags:   tags,
+		serial: m.uniqueSerial(),
+	}
+
+	m.streams = append(m.streams, stream)
+
+	return stream, nil
+}
+
+func (m *Muxer) uniqueSerial() uint32 {
+	for {
+		serial := rand.Uint32()
+
+		unique := true
+		for _, stream := range m.streams {
+			unique = unique && stream.serial != serial
+		}
+
+		if unique {
+			return serial
+		}
+	}
+}
+
+// writeHeaders writes identification headers of all streams on their own pages followed by
+// comment headers, as RFC 7845 requires both of them to be on separate pages.
+func (m *Muxer) writeHeaders() error {
+	if m.headersWritten {
+		return nil
+	}
+
+	m.headersWritten = true
+
+	for _, stream := range m.streams {
+		if err := stream.writeHeaderPacket(stream.head.Marshal(), headerTypeBOS); err != nil {
+			return fmt.Errorf("failed to write OpusHead: %w", err)
+		}
+	}
+
+	for _, stream := range m.streams {
+		if err := stream.writeHeaderPacket(stream.tags.marshal(), 0); err != nil {
+			return fmt.Errorf("failed to write OpusTags: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Close finishes all streams, marking their last pages as end of stream.
+func (m *Muxer) Close() error {
+	if m.closed {
+		return nil
+	}
+
+	if err := m.writeHeaders(); err != nil {
+		return err
+	}
+
+	m.closed = true
+
+	for _, stream := range m.streams {
+		if err := stream.flushPage(headerTypeEOS); err != nil {
+			return fmt.Errorf("failed to finish stream: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Granule returns granule position of the stream, which is a number of samples
+// (at 48kHz) the decoder outputs including pre-skip.
+func (s *Stream) Granule() uint64 {
+	return s.granule
+}
+
+// WritePacket appends opus packet to the stream.
+func (s *Stream) WritePacket(packet []byte) error {
+	if s.muxer.closed {
+		return ErrMuxerClosed
+	}
+
+	samples, err := PacketSamples(packet)
+	if err != nil {
+		return err
+	}
+
+	if err = s.muxer.writeHeaders(); err != nil {
+		return err
+	}
+
+	// the page is held until the next packet arrives, so the last page can be marked as end of stream
+	if len(s.page.payload)+len(packet) > maxPagePayload || s.pageSamples+samples > maxPageSamples {
+		if err = s.flushPage(0); err != nil {
+			return err
+		}
+	}
+
+	s.granule += uint64(samples)
+
+	if err = s.appendPacket(packet); err != nil {
+		return err
+	}
+
+	// packet is finished on the page being filled, even if it has begun on the flushed ones
+	s.pageSamples += samples
+
+	return nil
+}
+
+// appendPacket laces packet into the pages, flushing pages which run out of segments.
+func (s *Stream) appendPacket(packet []byte) error {
+	for {
+		free := maxSegments - len(s.page.segments)
+
+		// packet fits into the page, its length is terminated by the lacing value lower than 255
+		if len(packet)/255 < free {
+			for i := 0; i < len(packet)/255; i++ {
+				s.page.segments = append(s.page.segments, 255)
+			}
+
+			s.page.segments = append(s.page.segments, uint8(len(packet)%255))
+			s.page.payload = append(s.page.payload, packet...)
+			s.pageHasEnd = true
+			s.pageGranule = s.granule
+
+			return nil
+		}
+
+		for i := 0; i < free; i++ {
+			s.page.segments = append(s.page.segments, 255)
+		}
+
+		s.page.payload = append(s.page.payload, packet[:free*255]...)
+		packet = packet[free*255:]
+
+		if err := s.flushPage(0); err != nil {
+			return err
+		}
+
+		s.page.headerType |= headerTypeContinued
+	}
+}
+
+// writeHeaderPacket writes header packet on its own page(s).
+func (s *Stream) writeHeaderPacket(packet []byte, headerType uint8) error {
+	s.page.headerType |= headerType
+
+	if err := s.appendPacket(packet); err != nil {
+		return err
+	}
+
+	return s.flushPage(0)
+}
+
+// flushPage writes page being filled to the muxer output. Empty page is written only
+// when it has to carry end of stream flag.
+func (s *Stream) flushPage(headerType uint8) error {
+	if len(s.page.segments) == 0 && headerType&headerTypeEOS == 0 {
+		return nil
+	}
+
+	s.page.headerType |= headerType
+	s.page.serial = s.serial
+	s.page.sequence = s.sequence
+
+	// page ending with the unfinished packet is stamped with the packet finished before it
+	s.page.granule = s.pageGranule
+	if !s.pageHasEnd {
+		s.page.granule = noGranule
+	}
+
+	if _, err := s.muxer.out.Write(s.page.marshal()); err != nil {
+		return err
+	}
+
+	s.sequence++
+	s.page = page{}
+	s.pageSamples = 0
+	s.pageHasEnd = false
+
+	return nil
+}
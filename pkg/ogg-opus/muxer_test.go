@@ -0,0 +1,220 @@
+package oggopus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+const (
+	// tocCELT2_5ms is a TOC byte of a single 2.5 ms CELT frame (120 samples).
+	tocCELT2_5ms = 16 << 3
+	// tocCELT20ms is a TOC byte of a single 20 ms CELT frame (960 samples).
+	tocCELT20ms = 19 << 3
+)
+
+func makePacket(toc byte, size int, fill byte) []byte {
+	packet := bytes.Repeat([]byte{fill}, size)
+	packet[0] = toc
+
+	return packet
+}
+
+// readPages returns all pages of the muxed stream.
+func readPages(t *testing.T, data []byte) []page {
+	t.Helper()
+
+	in := bytes.NewReader(data)
+	pages := make([]page, 0)
+
+	for {
+		p, err := readPage(in)
+		if errors.Is(err, io.EOF) {
+			return pages
+		}
+		if err != nil {
+			t.Fatalf("failed to read page: %v", err)
+		}
+
+		pages = append(pages, p)
+	}
+}
+
+func TestMuxerRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+
+	muxer := NewMuxer(&out)
+
+	head := Head{Channels: 2, PreSkip: DefaultPreSkip, InputSampleRate: 48000, OutputGain: -256}
+	tags := Tags{Comments: []string{"TITLE=test"}}
+
+	first, err := muxer.AddStream(head, tags)
+	if err != nil {
+		t.Fatalf("failed to add stream: %v", err)
+	}
+
+	second, err := muxer.AddStream(Head{Channels: 1}, Tags{})
+	if err != nil {
+		t.Fatalf("failed to add stream: %v", err)
+	}
+
+	// sizes cover packets shorter than a segment, ending on the segment boundary, and spanning pages
+	sizes := []int{1, 100, 254, 255, 510, 3000, 4096, 70000, 20}
+	written := make([][]byte, 0, len(sizes))
+
+	for i, size := range sizes {
+		packet := makePacket(tocCELT20ms, size, byte(i))
+		written = append(written, packet)
+
+		if err = first.WritePacket(packet); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+
+		if err = second.WritePacket(makePacket(tocCELT2_5ms, 10, 0xFF)); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+
+	if _, err = muxer.AddStream(Head{}, Tags{}); !errors.Is(err, ErrStreamsSealed) {
+		t.Fatalf("stream added after packets: got %v, want %v", err, ErrStreamsSealed)
+	}
+
+	if err = muxer.Close(); err != nil {
+		t.Fatalf("failed to close muxer: %v", err)
+	}
+
+	if want := uint64(len(sizes) * 960); first.Granule() != want {
+		t.Errorf("granule = %d, want %d", first.Granule(), want)
+	}
+
+	reader := NewReader(bytes.NewReader(out.Bytes()))
+	read := make([][]byte, 0, len(sizes))
+
+	for {
+		packet, err := reader.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read packet: %v", err)
+		}
+
+		if packet.Serial == first.serial {
+			read = append(read, packet.Data)
+		}
+	}
+
+	if !slices.EqualFunc(read, written, bytes.Equal) {
+		t.Errorf("read %d packets differing from %d written", len(read), len(written))
+	}
+
+	readHead, _ := reader.Head(first.serial)
+	if readHead != head {
+		t.Errorf("head = %+v, want %+v", readHead, head)
+	}
+
+	readTags, _ := reader.Tags(first.serial)
+	if readTags.Vendor != vendor || !slices.Equal(readTags.Comments, tags.Comments) {
+		t.Errorf("tags = %+v, want %+v", readTags, tags)
+	}
+
+	pages := readPages(t, out.Bytes())
+	eos := 0
+
+	for _, p := range pages {
+		if p.headerType&headerTypeEOS != 0 {
+			eos++
+		}
+	}
+
+	if eos != 2 {
+		t.Errorf("%d pages are marked as end of stream, want 2", eos)
+	}
+}
+
+func TestMuxerGranuleOfSplitPacket(t *testing.T) {
+	var out bytes.Buffer
+
+	muxer := NewMuxer(&out)
+
+	stream, err := muxer.AddStream(Head{Channels: 2}, Tags{})
+	if err != nil {
+		t.Fatalf("failed to add stream: %v", err)
+	}
+
+	// small packets leave two free segments on the page, so the next one is split between pages
+	const finished = maxSegments - 2
+
+	for i := 0; i < finished; i++ {
+		if err = stream.WritePacket(makePacket(tocCELT2_5ms, 10, 0)); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+
+	if err = stream.WritePacket(makePacket(tocCELT2_5ms, 600, 0)); err != nil {
+		t.Fatalf("failed to write packet: %v", err)
+	}
+
+	if err = muxer.Close(); err != nil {
+		t.Fatalf("failed to close muxer: %v", err)
+	}
+
+	pages := readPages(t, out.Bytes())
+	if len(pages) != 4 {
+		t.Fatalf("got %d pages, want 4 (2 headers and 2 audio)", len(pages))
+	}
+
+	tests := []struct {
+		name    string
+		page    page
+		granule uint64
+	}{
+		{name: "page with the split packet", page: pages[2], granule: finished * 120},
+		{name: "page finishing the split packet", page: pages[3], granule: (finished + 1) * 120},
+	}
+
+	for _, tt := range tests {
+		if tt.page.granule != tt.granule {
+			t.Errorf("%s: granule = %d, want %d", tt.name, tt.page.granule, tt.granule)
+		}
+	}
+
+	if pages[3].headerType&headerTypeContinued == 0 {
+		t.Errorf("page finishing the split packet is not marked as continued")
+	}
+}
+
+func TestMuxerGranuleOfPageWithoutFinishedPacket(t *testing.T) {
+	var out bytes.Buffer
+
+	muxer := NewMuxer(&out)
+
+	stream, err := muxer.AddStream(Head{Channels: 2}, Tags{})
+	if err != nil {
+		t.Fatalf("failed to add stream: %v", err)
+	}
+
+	// packet of more than 255 segments begins on a page where no packet is finished
+	if err = stream.WritePacket(makePacket(tocCELT20ms, 70000, 0)); err != nil {
+		t.Fatalf("failed to write packet: %v", err)
+	}
+
+	if err = muxer.Close(); err != nil {
+		t.Fatalf("failed to close muxer: %v", err)
+	}
+
+	pages := readPages(t, out.Bytes())
+	if len(pages) != 4 {
+		t.Fatalf("got %d pages, want 4 (2 headers and 2 audio)", len(pages))
+	}
+
+	if pages[2].granule != noGranule {
+		t.Errorf("granule of the page without finished packets = %d, want %d", pages[2].granule, noGranule)
+	}
+
+	if pages[3].granule != 960 {
+		t.Errorf("granule of the last page = %d, want 960", pages[3].granule)
+	}
+}
@@ -0,0 +1,50 @@
+package oggopus
+
+import (
+	"errors"
+)
+
+var ErrInvalidPacket = errors.New("invalid opus packet")
+
+// PacketSamples returns duration of the opus packet in samples at 48kHz (RFC 6716, section 3.1).
+func PacketSamples(packet []byte) (int, error) {
+	if len(packet) == 0 {
+		return 0, ErrInvalidPacket
+	}
+
+	toc := packet[0]
+	config := toc >> 3
+
+	var frameSamples int
+
+	switch {
+	case config < 12: // SILK-only: 10, 20, 40 or 60 ms
+		frameSamples = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid: 10 or 20 ms
+		frameSamples = []int{480, 960}[config%2]
+	default: // CELT-only: 2.5, 5, 10 or 20 ms
+		frameSamples = []int{120, 240, 480, 960}[config%4]
+	}
+
+	var frames int
+
+	switch toc & 0x03 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, ErrInvalidPacket
+		}
+
+		frames = int(packet[1] & 0x3F)
+	}
+
+	samples := frames * frameSamples
+	if samples == 0 || samples > 5760 { // packet can not be longer than 120 ms
+		return 0, ErrInvalidPacket
+	}
+
+	return samples, nil
+}
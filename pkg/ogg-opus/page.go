@@ -0,0 +1,45 @@
+package oggopus
+
+import (
+	"encoding/binary"
+)
+
+const (
+	pageHeaderSize = 27
+	maxSegments    = 255
+
+	headerTypeContinued = 0x01
+	headerTypeBOS       = 0x02
+	headerTypeEOS       = 0x04
+
+	// noGranule is a granule position of the page on which no packet is finished.
+	noGranule = ^uint64(0)
+)
+
+// page is a single Ogg page (RFC 3533, section 6).
+type page struct {
+	headerType uint8
+	granule    uint64
+	serial     uint32
+	sequence   uint32
+	segments   []byte // lacing values
+	payload    []byte
+}
+
+func (p *page) marshal() []byte {
+	data := make([]byte, pageHeaderSize+len(p.segments)+len(p.payload))
+
+	copy(data, "OggS")
+	data[4] = 0 // version
+	data[5] = p.headerType
+	binary.LittleEndian.PutUint64(data[6:], p.granule)
+	binary.LittleEndian.PutUint32(data[14:], p.serial)
+	binary.LittleEndian.PutUint32(data[18:], p.sequence)
+	data[26] = uint8(len(p.segments))
+	copy(data[pageHeaderSize:], p.segments)
+	copy(data[pageHeaderSize+len(p.segments):], p.payload)
+
+	binary.LittleEndian.PutUint32(data[22:], crc32(data))
+
+	return data
+}
@@ -0,0 +1,203 @@
+package oggopus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrCorruptPage = errors.New("corrupt ogg page")
+
+// Packet is an audio packet of the logical stream.
+type Packet struct {
+	Serial uint32
+	Data   []byte
+}
+
+// Reader reads audio packets of all logical Ogg Opus streams from the reader. Headers of
+// streams are consumed by the Reader and are available through Head and Tags methods.
+type Reader struct {
+	in *bufio.Reader
+
+	streams map[uint32]*readStream
+	packets []Packet // packets of the last read page
+}
+
+type readStream struct {
+	head    Head
+	tags    Tags
+	headers int    // number of header packets read
+	partial []byte // beginning of the packet which continues on the next page
+}
+
+func NewReader(in io.Reader) *Reader {
+	return &Reader{
+		in:      bufio.NewReader(in),
+		streams: make(map[uint32]*readStream),
+	}
+}
+
+// ReadPacket returns next audio packet. It returns io.EOF at the end of the input and
+// io.ErrUnexpectedEOF when the input ends in the middle of a page.
+func (r *Reader) ReadPacket() (Packet, error) {
+	for len(r.packets) == 0 {
+		p, err := readPage(r.in)
+		if err != nil {
+			return Packet{}, err
+		}
+
+		if err = r.handlePage(p); err != nil {
+			return Packet{}, err
+		}
+	}
+
+	packet := r.packets[0]
+	r.packets = r.packets[1:]
+
+	return packet, nil
+}
+
+// Head returns identification header of the stream with given serial number.
+func (r *Reader) Head(serial uint32) (Head, bool) {
+	stream, found := r.streams[serial]
+	if !found || stream.headers < 1 {
+		return Head{}, false
+	}
+
+	return stream.head, true
+}
+
+// Tags returns comment header of the stream with given serial number.
+func (r *Reader) Tags(serial uint32) (Tags, bool) {
+	stream, found := r.streams[serial]
+	if !found || stream.headers < 2 {
+		return Tags{}, false
+	}
+
+	return stream.tags, true
+}
+
+func (r *Reader) handlePage(p page) error {
+	stream, found := r.streams[p.serial]
+	if !found {
+		if p.headerType&headerTypeBOS == 0 {
+			return fmt.Errorf("%w: page of unknown stream %d", ErrCorruptPage, p.serial)
+		}
+
+		stream = &readStream{}
+		r.streams[p.serial] = stream
+	}
+
+	if p.headerType&headerTypeContinued == 0 {
+		stream.partial = nil
+	}
+
+	payload := p.payload
+
+	for _, segment := range p.segments {
+		stream.partial = append(stream.partial, payload[:segment]...)
+		payload = payload[segment:]
+
+		// lacing value lower than 255 terminates the packet, so the packet which ends with
+		// 255 on the last segment of the page continues on the next page
+		if segment == 255 {
+			continue
+		}
+
+		packet := stream.partial
+		stream.partial = nil
+
+		if err := r.handlePacket(p.serial, stream, packet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) handlePacket(serial uint32, stream *readStream, packet []byte) error {
+	var err error
+
+	switch stream.headers {
+	case 0:
+		stream.head, err = parseHead(packet)
+	case 1:
+		stream.tags, err = parseTags(packet)
+	default:
+		r.packets = append(r.packets, Packet{Serial: serial, Data: packet})
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	stream.headers++
+
+	return nil
+}
+
+// readPage reads and verifies single page from the input.
+func readPage(in io.Reader) (page, error) {
+	header := make([]byte, pageHeaderSize)
+
+	if _, err := io.ReadFull(in, header); err != nil {
+		return page{}, err
+	}
+
+	if string(header[:4]) != "OggS" || header[4] != 0 {
+		return page{}, fmt.Errorf("%w: bad capture pattern", ErrCorruptPage)
+	}
+
+	p := page{
+		headerType: header[5],
+		granule:    binary.LittleEndian.Uint64(header[6:]),
+		serial:     binary.LittleEndian.Uint32(header[14:]),
+		sequence:   binary.LittleEndian.Uint32(header[18:]),
+		segments:   make([]byte, header[26]),
+	}
+
+	if _, err := io.ReadFull(in, p.segments); err != nil {
+		return page{}, unexpectedEOF(err)
+	}
+
+	size := 0
+	for _, segment := range p.segments {
+		size += int(segment)
+	}
+
+	p.payload = make([]byte, size)
+
+	if _, err := io.ReadFull(in, p.payload); err != nil {
+		return page{}, unexpectedEOF(err)
+	}
+
+	if binary.LittleEndian.Uint32(header[22:]) != crc32(p.withoutChecksum(header)) {
+		return page{}, fmt.Errorf("%w: checksum mismatch", ErrCorruptPage)
+	}
+
+	return p, nil
+}
+
+// withoutChecksum returns raw page with zeroed checksum field, as it is used for checksum computation.
+func (p *page) withoutChecksum(header []byte) []byte {
+	raw := make([]byte, 0, len(header)+len(p.segments)+len(p.payload))
+
+	raw = append(raw, header[:22]...)
+	raw = append(raw, 0, 0, 0, 0)
+	raw = append(raw, header[26])
+	raw = append(raw, p.segments...)
+	raw = append(raw, p.payload...)
+
+	return raw
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,69 @@
+package oggopus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Repair rewrites the first logical stream of possibly damaged Ogg Opus input into the output.
+// Every packet read before the damage (truncated or corrupt page) is kept, and the stream is
+// properly finished with end of stream page. It returns identification header and granule
+// position of the repaired stream.
+func Repair(out io.Writer, in io.Reader) (Head, uint64, error) {
+	return remux(out, in, nil, true)
+}
+
+// Rewrite rewrites the first logical stream of Ogg Opus input into the output with headers
+// changed by edit. Audio packets are copied as they are.
+func Rewrite(out io.Writer, in io.Reader, edit func(head Head, tags Tags) (Head, Tags)) error {
+	_, _, err := remux(out, in, edit, false)
+	return err
+}
+
+func remux(out io.Writer, in io.Reader, edit func(head Head, tags Tags) (Head, Tags), repair bool) (Head, uint64, error) {
+	reader := NewReader(in)
+
+	first, err := reader.ReadPacket()
+	if err != nil {
+		return Head{}, 0, fmt.Errorf("failed to read first packet: %w", err)
+	}
+
+	head, _ := reader.Head(first.Serial)
+	tags, _ := reader.Tags(first.Serial)
+
+	if edit != nil {
+		head, tags = edit(head, tags)
+	}
+
+	muxer := NewMuxer(out)
+
+	stream, err := muxer.AddStream(head, tags)
+	if err != nil {
+		return Head{}, 0, err
+	}
+
+	for packet := first; ; {
+		if packet.Serial == first.Serial {
+			if err = stream.WritePacket(packet.Data); err != nil {
+				return Head{}, 0, fmt.Errorf("failed to write packet: %w", err)
+			}
+		}
+
+		packet, err = reader.ReadPacket()
+		if err != nil {
+			break
+		}
+	}
+
+	damaged := errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrCorruptPage)
+	if !errors.Is(err, io.EOF) && !(repair && damaged) {
+		return Head{}, 0, fmt.Errorf("failed to read packet: %w", err)
+	}
+
+	if err = muxer.Close(); err != nil {
+		return Head{}, 0, err
+	}
+
+	return head, stream.Granule(), nil
+}
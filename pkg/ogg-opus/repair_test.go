@@ -0,0 +1,153 @@
+package oggopus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// muxPackets returns Ogg Opus stream of count 20 ms packets, each page holding a second of audio.
+func muxPackets(t *testing.T, count int) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	muxer := NewMuxer(&out)
+
+	stream, err := muxer.AddStream(Head{Channels: 2, PreSkip: DefaultPreSkip}, Tags{Comments: []string{"TITLE=test"}})
+	if err != nil {
+		t.Fatalf("failed to add stream: %v", err)
+	}
+
+	for i := 0; i < count; i++ {
+		if err = stream.WritePacket(makePacket(tocCELT20ms, 40, byte(i))); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+
+	if err = muxer.Close(); err != nil {
+		t.Fatalf("failed to close muxer: %v", err)
+	}
+
+	return out.Bytes()
+}
+
+func countPackets(t *testing.T, data []byte) int {
+	t.Helper()
+
+	reader := NewReader(bytes.NewReader(data))
+	count := 0
+
+	for {
+		_, err := reader.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			return count
+		}
+		if err != nil {
+			t.Fatalf("failed to read packet: %v", err)
+		}
+
+		count++
+	}
+}
+
+func TestRepair(t *testing.T) {
+	stream := muxPackets(t, 120) // pages of 50 packets: 50, 50 and 20
+
+	pages := readPages(t, stream)
+	pageSize := func(p page) int { return pageHeaderSize + len(p.segments) + len(p.payload) }
+
+	headersSize := pageSize(pages[0]) + pageSize(pages[1])
+	firstAudioEnd := headersSize + pageSize(pages[2])
+
+	corrupt := bytes.Clone(stream)
+	corrupt[firstAudioEnd+pageHeaderSize+10] ^= 0xFF // payload of the second audio page
+
+	tests := []struct {
+		name    string
+		data    []byte
+		packets int
+	}{
+		{name: "complete stream", data: stream, packets: 120},
+		{name: "truncated in the middle of the page", data: stream[:firstAudioEnd+100], packets: 50},
+		{name: "truncated on the page boundary", data: stream[:firstAudioEnd], packets: 50},
+		{name: "corrupt page", data: corrupt, packets: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			head, granule, err := Repair(&out, bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("failed to repair stream: %v", err)
+			}
+
+			if head.PreSkip != DefaultPreSkip {
+				t.Errorf("pre-skip = %d, want %d", head.PreSkip, DefaultPreSkip)
+			}
+
+			if want := uint64(tt.packets * 960); granule != want {
+				t.Errorf("granule = %d, want %d", granule, want)
+			}
+
+			if packets := countPackets(t, out.Bytes()); packets != tt.packets {
+				t.Errorf("repaired stream has %d packets, want %d", packets, tt.packets)
+			}
+
+			repaired := readPages(t, out.Bytes())
+			if last := repaired[len(repaired)-1]; last.headerType&headerTypeEOS == 0 {
+				t.Errorf("last page is not marked as end of stream")
+			}
+		})
+	}
+}
+
+func TestRepairWithoutAudio(t *testing.T) {
+	stream := muxPackets(t, 10)
+	pages := readPages(t, stream)
+
+	headersSize := pageHeaderSize + len(pages[0].segments) + len(pages[0].payload)
+
+	if _, _, err := Repair(io.Discard, bytes.NewReader(stream[:headersSize])); err == nil {
+		t.Errorf("stream without audio packets is repaired")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	stream := muxPackets(t, 60)
+
+	var out bytes.Buffer
+
+	err := Rewrite(&out, bytes.NewReader(stream), func(head Head, tags Tags) (Head, Tags) {
+		head.OutputGain = 3 << 8
+		tags.Comments = append(tags.Comments, "ARTIST=someone")
+
+		return head, tags
+	})
+	if err != nil {
+		t.Fatalf("failed to rewrite stream: %v", err)
+	}
+
+	reader := NewReader(bytes.NewReader(out.Bytes()))
+
+	packet, err := reader.ReadPacket()
+	if err != nil {
+		t.Fatalf("failed to read packet: %v", err)
+	}
+
+	head, _ := reader.Head(packet.Serial)
+	if head.OutputGain != 3<<8 {
+		t.Errorf("output gain = %d, want %d", head.OutputGain, 3<<8)
+	}
+
+	tags, _ := reader.Tags(packet.Serial)
+	if len(tags.Comments) != 2 || tags.Comments[1] != "ARTIST=someone" {
+		t.Errorf("comments = %q", tags.Comments)
+	}
+
+	if packets := countPackets(t, out.Bytes()); packets != 60 {
+		t.Errorf("rewritten stream has %d packets, want 60", packets)
+	}
+}
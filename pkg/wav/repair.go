@@ -0,0 +1,54 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrInvalidHeader = errors.New("invalid wave header")
+
+// Repair updates sizes in the header of the file written by the Writer which has not been
+// closed, so they match the data actually written. Incomplete sample frame at the end of
+// the file is excluded from the data. It returns number of sample frames in the file.
+func Repair(file io.ReadWriteSeeker) (int64, error) {
+	header := make([]byte, headerSize)
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek to header: %w", err)
+	}
+
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" || string(header[36:40]) != "data" {
+		return 0, ErrInvalidHeader
+	}
+
+	blockAlign := int64(binary.LittleEndian.Uint16(header[32:]))
+	if blockAlign == 0 {
+		return 0, ErrInvalidHeader
+	}
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to seek to the end: %w", err)
+	}
+
+	dataSize := (size - headerSize) / blockAlign * blockAlign
+
+	binary.LittleEndian.PutUint32(header[4:], uint32(dataSize+headerSize-8))
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek to header: %w", err)
+	}
+
+	if _, err = file.Write(header); err != nil {
+		return 0, err
+	}
+
+	return dataSize / blockAlign, nil
+}
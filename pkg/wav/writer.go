@@ -0,0 +1,108 @@
+// Package wav implements writer of 16-bit PCM WAVE files.
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const headerSize = 44
+
+// Writer writes interleaved 16-bit pcm into WAVE file. When the output is not seekable, sizes
+// in the header can not be known in advance and are set to the maximum value, which is
+// understood by most of the players as "read until the end of the file".
+type Writer struct {
+	out io.Writer
+
+	sampleRate int
+	channels   int
+	dataSize   uint32
+
+	headerWritten bool
+	buf           []byte
+}
+
+func NewWriter(out io.Writer, sampleRate, channels int) *Writer {
+	return &Writer{
+		out:        out,
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+}
+
+// Write writes interleaved pcm samples.
+func (w *Writer) Write(pcm []int16) error {
+	if !w.headerWritten {
+		if err := w.writeHeader(math.MaxUint32 - headerSize); err != nil {
+			return err
+		}
+
+		w.headerWritten = true
+	}
+
+	w.buf = w.buf[:0]
+	for _, sample := range pcm {
+		w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(sample))
+	}
+
+	if _, err := w.out.Write(w.buf); err != nil {
+		return err
+	}
+
+	w.dataSize += uint32(len(w.buf))
+
+	return nil
+}
+
+// Close updates sizes in the header if the output is seekable. It does not close the output.
+func (w *Writer) Close() error {
+	if !w.headerWritten {
+		w.headerWritten = true
+		return w.writeHeader(0)
+	}
+
+	seeker, ok := w.out.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to header: %w", err)
+	}
+
+	if err := w.writeHeader(w.dataSize); err != nil {
+		return err
+	}
+
+	_, err := seeker.Seek(0, io.SeekEnd)
+
+	return err
+}
+
+func (w *Writer) writeHeader(dataSize uint32) error {
+	blockAlign := w.channels * 2
+
+	header := make([]byte, 0, headerSize)
+
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize+headerSize-8)
+	header = append(header, "WAVE"...)
+
+	header = append(header, "fmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1) // PCM
+	header = binary.LittleEndian.AppendUint16(header, uint16(w.channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(w.sampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(w.sampleRate*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, 16) // bits per sample
+
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize)
+
+	_, err := w.out.Write(header)
+
+	return err
+}
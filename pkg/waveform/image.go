@@ -0,0 +1,54 @@
+package waveform
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+var (
+	backgroundColor = color.RGBA{R: 0x2B, G: 0x2D, B: 0x31, A: 0xFF}
+	waveformColor   = color.RGBA{R: 0x58, G: 0x65, B: 0xF2, A: 0xFF}
+	axisColor       = color.RGBA{R: 0x4E, G: 0x50, B: 0x58, A: 0xFF}
+)
+
+// WritePNG renders peaks stretched over the image of given size and writes it as PNG.
+func (p *Peaks) WritePNG(out io.Writer, width, height int) error {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.SetRGBA(x, y, backgroundColor)
+		}
+
+		img.SetRGBA(x, height/2, axisColor)
+	}
+
+	// y of the sample value, from the top for the maximum to the bottom for the minimum
+	toY := func(value int16) int {
+		return int(math.Round((1 - (float64(value)-math.MinInt16)/(math.MaxInt16-math.MinInt16)) * float64(height-1)))
+	}
+
+	for x := 0; x < width && p.Len() != 0; x++ {
+		from := x * p.Len() / width
+		to := max(from+1, (x+1)*p.Len()/width)
+
+		low, high := int16(math.MaxInt16), int16(math.MinInt16)
+		for i := from; i < min(to, p.Len()); i++ {
+			low = min(low, p.data[i*2])
+			high = max(high, p.data[i*2+1])
+		}
+
+		if low > high {
+			continue
+		}
+
+		for y := toY(high); y <= toY(low); y++ {
+			img.SetRGBA(x, y, waveformColor)
+		}
+	}
+
+	return png.Encode(out, img)
+}
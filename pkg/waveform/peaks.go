@@ -0,0 +1,114 @@
+// Package waveform computes waveform peaks of audio in the JSON format of audiowaveform
+// and renders them as an image.
+package waveform
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Peaks are minimum and maximum sample values of audio in every interval of samplesPerPixel
+// samples. Channels are combined into one.
+type Peaks struct {
+	sampleRate      int
+	samplesPerPixel int
+
+	data []int16 // pairs of minimum and maximum values
+
+	min, max int16
+	samples  int // number of samples in the current interval
+}
+
+func NewPeaks(sampleRate, samplesPerPixel int) *Peaks {
+	return &Peaks{
+		sampleRate:      sampleRate,
+		samplesPerPixel: samplesPerPixel,
+		min:             math.MaxInt16,
+		max:             math.MinInt16,
+	}
+}
+
+// Write adds interleaved pcm with given number of channels.
+func (p *Peaks) Write(pcm []int16, channels int) {
+	for i := 0; i+channels <= len(pcm); i += channels {
+		for _, sample := range pcm[i : i+channels] {
+			p.min = min(p.min, sample)
+			p.max = max(p.max, sample)
+		}
+
+		p.samples++
+		if p.samples == p.samplesPerPixel {
+			p.flush()
+		}
+	}
+}
+
+// Finish adds peaks of the incomplete interval at the end of the audio.
+func (p *Peaks) Finish() {
+	if p.samples != 0 {
+		p.flush()
+	}
+}
+
+func (p *Peaks) flush() {
+	p.data = append(p.data, p.min, p.max)
+
+	p.min, p.max = math.MaxInt16, math.MinInt16
+	p.samples = 0
+}
+
+// Len returns number of intervals.
+func (p *Peaks) Len() int {
+	return len(p.data) / 2
+}
+
+// Zoom returns peaks with factor times more samples per interval.
+func (p *Peaks) Zoom(factor int) *Peaks {
+	zoomed := NewPeaks(p.sampleRate, p.samplesPerPixel*factor)
+
+	for i := 0; i < p.Len(); i += factor {
+		low, high := int16(math.MaxInt16), int16(math.MinInt16)
+
+		for j := i; j < min(i+factor, p.Len()); j++ {
+			low = min(low, p.data[j*2])
+			high = max(high, p.data[j*2+1])
+		}
+
+		zoomed.data = append(zoomed.data, low, high)
+	}
+
+	return zoomed
+}
+
+// MarshalJSON encodes peaks in the format of audiowaveform (version 2) with 8-bit values.
+func (p *Peaks) MarshalJSON() ([]byte, error) {
+	data := make([]int8, len(p.data))
+	for i, value := range p.data {
+		data[i] = int8(value >> 8)
+	}
+
+	// int8 slice is encoded as numbers, unlike byte slice
+	encoded, err := json.Marshal(struct {
+		Version         int    `json:"version"`
+		Channels        int    `json:"channels"`
+		SampleRate      int    `json:"sample_rate"`
+		SamplesPerPixel int    `json:"samples_per_pixel"`
+		Bits            int    `json:"bits"`
+		Length          int    `json:"length"`
+		Data            []int8 `json:"data"`
+	}{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      p.sampleRate,
+		SamplesPerPixel: p.samplesPerPixel,
+		Bits:            8,
+		Length:          p.Len(),
+		Data:            data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal waveform: %w", err)
+	}
+
+	return encoded, nil
+}